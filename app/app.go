@@ -1,68 +1,360 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"math/rand"
 	"os"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
-func Run(makeDb func(dbfile string) Db) {
+// Run parses the command line and runs the benchmarks with databases
+// opened by makeDb. A benchmark iteration that fails is reported with its
+// error, and the run continues with the next benchmark. If any iteration
+// failed, Run exits with status 1 after all benchmarks have run.
+func Run(makeDb func(dbfile string) (Db, error)) {
 	log.SetOutput(os.Stdout)
 	log.SetFlags(0)
-	log.Print("")
+	benchFlag := flag.String("bench", "simple,complex,many,large,concurrent,cancel,lookup,update,upsert,batch", "comma-separated list of benchmarks to run")
+	usersFlag := flag.Int("users", 1_000_000, "number of users for the simple, concurrent, lookup and upsert benchmarks")
+	manySizesFlag := flag.String("many-sizes", "10,100,1000", "comma-separated user counts for the many benchmark")
+	largeSizesFlag := flag.String("large-sizes", "50000,100000,200000", "comma-separated row sizes for the large benchmark")
+	goroutinesFlag := flag.String("goroutines", "2,4,8", "comma-separated goroutine counts for the concurrent benchmark")
+	batchSizesFlag := flag.String("batch-sizes", "0,1,10,100,1000", "comma-separated rows per transaction for the batch benchmark, 0 means autocommit")
+	lookupsFlag := flag.Int("lookups", 200_000, "number of primary key lookups for the lookup benchmark")
+	cancelAfterFlag := flag.Duration("cancel-after", 100*time.Millisecond, "time after which the cancel benchmark cancels its query")
+	journalModeFlag := flag.String("journal-mode", DefaultJournalMode, "comma-separated journal modes: "+strings.Join(journalModes, ", "))
+	synchronousFlag := flag.String("synchronous", DefaultSynchronous, "comma-separated synchronous settings: "+strings.Join(synchronousModes, ", "))
+	matrixFlag := flag.Bool("matrix", false, "run the benchmarks for all journal modes and synchronous settings")
+	iterationsFlag := flag.Int("iterations", 1, "number of measured iterations per benchmark")
+	warmupFlag := flag.Int("warmup", 0, "number of unmeasured warmup iterations per benchmark")
+	outputFlag := flag.String("output", "text", "output format: text, json, csv or benchstat")
+	unitFlag := flag.String("unit", "ms", "time unit for text output: ns, us, ms or s")
+	verboseFlag := flag.Bool("verbose", false, "verbose output")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] dbfile\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 	dbfile := flag.Arg(0)
 	if dbfile == "" {
 		log.Fatal("dbfile empty, cannot bench")
 	}
+	// output
+	rep := newReporter(*outputFlag, *unitFlag, os.Stdout)
+	if *outputFlag == "text" {
+		log.Print("")
+	} else {
+		// keep stdout clean for machine-readable output
+		log.SetOutput(os.Stderr)
+	}
 	// verbose
-	const verbose = false
+	verbose := *verboseFlag
 	if verbose {
 		log.Printf("dbfile %q", dbfile)
 	}
-	// run benchmarks
+	// parse flags
 	benchmarks := map[string]bool{
-		"simple":     true,
-		"complex":    true,
-		"many":       true,
-		"large":      true,
-		"concurrent": true,
+		"simple":     false,
+		"complex":    false,
+		"many":       false,
+		"large":      false,
+		"concurrent": false,
+		"cancel":     false,
+		"lookup":     false,
+		"update":     false,
+		"upsert":     false,
+		"batch":      false,
+	}
+	for _, name := range SplitList(*benchFlag) {
+		if _, ok := benchmarks[name]; !ok {
+			log.Fatalf("unknown benchmark %q", name)
+		}
+		benchmarks[name] = true
+	}
+	nusers := *usersFlag
+	if nusers < 1 {
+		log.Fatalf("invalid users %d, must be >= 1", nusers)
+	}
+	manySizes := mustParseInts("many-sizes", *manySizesFlag, 1)
+	largeSizes := mustParseInts("large-sizes", *largeSizesFlag, 1)
+	goroutines := mustParseInts("goroutines", *goroutinesFlag, 1)
+	batchSizes := mustParseInts("batch-sizes", *batchSizesFlag, 0)
+	iterations := *iterationsFlag
+	if iterations < 1 {
+		log.Fatalf("invalid iterations %d, must be >= 1", iterations)
+	}
+	warmup := *warmupFlag
+	if warmup < 0 {
+		log.Fatalf("invalid warmup %d, must be >= 0", warmup)
+	}
+	nlookups := *lookupsFlag
+	if nlookups < 2 {
+		log.Fatalf("invalid lookups %d, must be >= 2", nlookups)
+	}
+	if *matrixFlag {
+		*journalModeFlag = strings.Join(journalModes, ",")
+		*synchronousFlag = strings.Join(synchronousModes, ",")
+	}
+	pragmaSets := mustParsePragmas(*journalModeFlag, *synchronousFlag)
+	cancelAfter := *cancelAfterFlag
+	if cancelAfter <= 0 {
+		log.Fatalf("invalid cancel-after %s, must be > 0", cancelAfter)
+	}
+	// collect benchmarks, for each combination of pragmas
+	var runs []benchmark
+	for _, p := range pragmaSets {
+		if benchmarks["simple"] {
+			runs = append(runs, benchmark{"simple", 0, "1_simple", p, func(ctx context.Context) result {
+				return benchSimple(ctx, dbfile, p, verbose, nusers, makeDb)
+			}})
+		}
+		if benchmarks["complex"] {
+			runs = append(runs, benchmark{"complex", 0, "2_complex", p, func(ctx context.Context) result {
+				return benchComplex(ctx, dbfile, p, verbose, makeDb)
+			}})
+		}
+		if benchmarks["many"] {
+			for _, n := range manySizes {
+				runs = append(runs, benchmark{"many", n, fmt.Sprintf("3_many/%04d", n), p, func(ctx context.Context) result {
+					return benchMany(ctx, dbfile, p, verbose, n, makeDb)
+				}})
+			}
+		}
+		if benchmarks["large"] {
+			for _, n := range largeSizes {
+				runs = append(runs, benchmark{"large", n, fmt.Sprintf("4_large/%06d", n), p, func(ctx context.Context) result {
+					return benchLarge(ctx, dbfile, p, verbose, n, makeDb)
+				}})
+			}
+		}
+		if benchmarks["concurrent"] {
+			for _, n := range goroutines {
+				runs = append(runs, benchmark{"concurrent", n, fmt.Sprintf("5_concurrent/%d", n), p, func(ctx context.Context) result {
+					return benchConcurrent(ctx, dbfile, p, verbose, nusers, n, makeDb)
+				}})
+			}
+		}
+		if benchmarks["cancel"] {
+			runs = append(runs, benchmark{"cancel", 0, "6_cancel", p, func(ctx context.Context) result {
+				return benchCancel(ctx, dbfile, p, verbose, cancelAfter, makeDb)
+			}})
+		}
+		if benchmarks["lookup"] {
+			runs = append(runs, benchmark{"lookup", 0, "7_lookup", p, func(ctx context.Context) result {
+				return benchLookup(ctx, dbfile, p, verbose, nusers, nlookups, makeDb)
+			}})
+		}
+		if benchmarks["update"] {
+			runs = append(runs, benchmark{"update", 0, "8_update", p, func(ctx context.Context) result {
+				return benchUpdate(ctx, dbfile, p, verbose, makeDb)
+			}})
+		}
+		if benchmarks["upsert"] {
+			runs = append(runs, benchmark{"upsert", 0, "9_upsert", p, func(ctx context.Context) result {
+				return benchUpsert(ctx, dbfile, p, verbose, nusers, makeDb)
+			}})
+		}
+		if benchmarks["batch"] {
+			for _, n := range batchSizes {
+				runs = append(runs, benchmark{"batch", n, fmt.Sprintf("10_batch/%04d", n), p, func(ctx context.Context) result {
+					return benchBatch(ctx, dbfile, p, verbose, n, makeDb)
+				}})
+			}
+		}
+	}
+	ctx := context.Background()
+	// environment
+	removeDbfiles(dbfile)
+	db, err := makeDb(dbfile)
+	if err != nil {
+		log.Fatalf("cannot open %s: %s", dbfile, err)
 	}
-	if benchmarks["simple"] {
-		benchSimple(dbfile, verbose, makeDb)
+	driver := db.DriverName()
+	rep.header(readEnv(ctx, db))
+	db.Close()
+	// run benchmarks
+	var failures int
+	for _, b := range runs {
+		for i := 0; i < warmup; i++ {
+			if verbose {
+				log.Printf("%s - warmup %d/%d", b, i+1, warmup)
+			}
+			b.safeRun(ctx)
+		}
+		var records []Record
+		for i := 0; i < iterations; i++ {
+			if verbose {
+				log.Printf("%s - iteration %d/%d", b, i+1, iterations)
+			}
+			res := b.safeRun(ctx)
+			if res.unsupported != "" {
+				log.Printf("%s - %s - not supported: %s", b, driver, res.unsupported)
+				break
+			}
+			if res.err != nil {
+				failures++
+			}
+			records = append(records, res.records(b, driver, i+1)...)
+		}
+		if len(records) > 0 {
+			rep.report(b, records)
+		}
 	}
-	if benchmarks["complex"] {
-		benchComplex(dbfile, verbose, makeDb)
+	rep.close()
+	if failures > 0 {
+		log.Printf("%d benchmark iterations failed", failures)
+		os.Exit(1)
 	}
-	if benchmarks["many"] {
-		benchMany(dbfile, verbose, 10, makeDb)
-		benchMany(dbfile, verbose, 100, makeDb)
-		benchMany(dbfile, verbose, 1_000, makeDb)
+}
+
+// benchmark is a benchmark run with a specific parameter.
+type benchmark struct {
+	name    string  // e.g. "many"
+	param   int     // e.g. number of users, 0 if not applicable
+	label   string  // e.g. "3_many/0010"
+	pragmas pragmas // the database configuration
+	run     func(ctx context.Context) result
+}
+
+// String returns the label and the pragmas, e.g. "3_many/0010 WAL/NORMAL".
+func (b benchmark) String() string {
+	return b.label + " " + b.pragmas.String()
+}
+
+// safeRun runs one iteration of the benchmark. If the driver panics, the
+// iteration is reported as failed, so that the run can continue.
+func (b benchmark) safeRun(ctx context.Context) (res result) {
+	defer func() {
+		if p := recover(); p != nil {
+			res = failed("run", fmt.Errorf("panic: %v", p))
+		}
+	}()
+	return b.run(ctx)
+}
+
+// result holds the measured phases of one benchmark iteration.
+type result struct {
+	phases   []phase
+	dbsize   int64
+	err      error  // non-nil if the iteration failed
+	errPhase string // the phase that failed, e.g. "insert"
+	// why the driver does not support the benchmark, "" if it does
+	unsupported string
+}
+
+// phase is a measured phase of a benchmark iteration.
+type phase struct {
+	name    string // e.g. "insert"
+	m       measurement
+	nrows   int      // number of rows inserted or scanned
+	metrics []metric // additional metrics of the phase, may be nil
+}
+
+// metric is an additional metric of a phase, e.g. whether a query was
+// cancelled.
+type metric struct {
+	value float64
+	unit  string
+}
+
+// failed returns the result of an iteration that failed in a phase.
+func failed(phase string, err error) result {
+	return result{err: err, errPhase: phase}
+}
+
+// unsupported returns the result of a benchmark that the driver does not
+// support. It has no records.
+func unsupported(reason string) result {
+	return result{unsupported: reason}
+}
+
+// records converts a result into one Record per measurement, into one
+// error Record if the iteration failed, or into none if the benchmark is
+// not supported.
+// Durations are recorded in nanoseconds, reporters may convert them.
+func (r result) records(b benchmark, driver string, iteration int) []Record {
+	if r.unsupported != "" {
+		return nil
 	}
-	if benchmarks["large"] {
-		benchLarge(dbfile, verbose, 50_000, makeDb)
-		benchLarge(dbfile, verbose, 100_000, makeDb)
-		benchLarge(dbfile, verbose, 200_000, makeDb)
+	if r.err != nil {
+		return []Record{newErrorRecord(b, r.errPhase, driver, r.err, iteration)}
 	}
-	if benchmarks["concurrent"] {
-		benchConcurrent(dbfile, verbose, 2, makeDb)
-		benchConcurrent(dbfile, verbose, 4, makeDb)
-		benchConcurrent(dbfile, verbose, 8, makeDb)
+	var records []Record
+	for _, p := range r.phases {
+		records = append(records, p.m.records(b, p.name, driver, p.nrows, iteration)...)
+		for _, m := range p.metrics {
+			records = append(records, newRecord(b, p.name, driver, m.value, m.unit, iteration))
+		}
 	}
+	records = append(records, newRecord(b, "dbsize", driver, float64(r.dbsize), "bytes", iteration))
+	return records
 }
 
 const insertUserSql = "INSERT INTO users(id,created,email,active) VALUES(?,?,?,?)"
 const insertArticleSql = "INSERT INTO articles(id,created,userId,text) VALUES(?,?,?,?)"
 const insertCommentSql = "INSERT INTO comments(id,created,articleId,text) VALUES(?,?,?,?)"
 
-func initSchema(db Db) {
-	db.Exec(
-		"PRAGMA journal_mode=DELETE",
-		"PRAGMA synchronous=FULL",
+// Default pragmas of the benchmarks, see -journal-mode and -synchronous.
+const (
+	DefaultJournalMode = "DELETE"
+	DefaultSynchronous = "FULL"
+)
+
+// journalModes and synchronousModes are the pragma values of the matrix
+// mode, see -matrix.
+var (
+	journalModes     = []string{"DELETE", "TRUNCATE", "WAL", "MEMORY", "OFF"}
+	synchronousModes = []string{"OFF", "NORMAL", "FULL"}
+)
+
+// pragmas is the configuration of a database that a benchmark runs with.
+type pragmas struct {
+	journalMode string // e.g. "WAL"
+	synchronous string // e.g. "NORMAL"
+}
+
+func (p pragmas) String() string {
+	return p.journalMode + "/" + p.synchronous
+}
+
+// mustParsePragmas returns all combinations of the journal modes and
+// synchronous settings in the comma-separated lists.
+func mustParsePragmas(journalModesList string, synchronousList string) []pragmas {
+	parse := func(flagName string, s string, valid []string) []string {
+		var values []string
+		for _, item := range SplitList(s) {
+			item = strings.ToUpper(item)
+			if !slices.Contains(valid, item) {
+				log.Fatalf("invalid %s %q, must be one of %s", flagName, item, strings.Join(valid, ","))
+			}
+			values = append(values, item)
+		}
+		if len(values) == 0 {
+			log.Fatalf("invalid %s %q, must not be empty", flagName, s)
+		}
+		return values
+	}
+	var all []pragmas
+	for _, j := range parse("journal-mode", journalModesList, journalModes) {
+		for _, s := range parse("synchronous", synchronousList, synchronousModes) {
+			all = append(all, pragmas{j, s})
+		}
+	}
+	return all
+}
+
+func initSchema(ctx context.Context, db Db, p pragmas) error {
+	return db.Exec(ctx,
+		"PRAGMA journal_mode="+p.journalMode,
+		"PRAGMA synchronous="+p.synchronous,
 		"PRAGMA foreign_keys=1",
 		"PRAGMA busy_timeout=5000", // 5s busy timeout
 		"CREATE TABLE users ("+
@@ -88,17 +380,48 @@ func initSchema(db Db) {
 	)
 }
 
-// Insert 1 million user rows in one database transaction.
-// Then query all users once.
-func benchSimple(dbfile string, verbose bool, makeDb func(dbfile string) Db) {
+// openDb removes old database files, opens a new database and creates
+// the schema.
+func openDb(ctx context.Context, dbfile string, p pragmas, makeDb func(dbfile string) (Db, error)) (Db, error) {
 	removeDbfiles(dbfile)
-	db := makeDb(dbfile)
+	db, err := makeDb(dbfile)
+	if err != nil {
+		return nil, err
+	}
+	err = initSchema(ctx, db, p)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// scanUsers scans all users of a query without collecting them, and
+// checks that there are nusers users.
+func scanUsers(ctx context.Context, db Db, querySql string, nusers int) error {
+	var n int
+	err := db.ScanUsers(ctx, querySql, func(User) error {
+		n++
+		return nil
+	})
+	if err == nil && n != nusers {
+		err = fmt.Errorf("want %d users but got %d", nusers, n)
+	}
+	return err
+}
+
+// Insert 1 million (see -users) user rows in one database transaction.
+// Then query all users once.
+// Then scan all users once without collecting them.
+func benchSimple(ctx context.Context, dbfile string, p pragmas, verbose bool, nusers int, makeDb func(dbfile string) (Db, error)) result {
+	db, err := openDb(ctx, dbfile, p, makeDb)
+	if err != nil {
+		return failed("setup", err)
+	}
 	defer db.Close()
-	initSchema(db)
 	// insert users
 	var users []User
 	base := time.Date(2023, 10, 1, 10, 0, 0, 0, time.Local)
-	const nusers = 1_000_000
 	for i := 0; i < nusers; i++ {
 		users = append(users, NewUser(
 			i+1,                                      // id,
@@ -107,43 +430,54 @@ func benchSimple(dbfile string, verbose bool, makeDb func(dbfile string) Db) {
 			true,                                     // active,
 		))
 	}
-	t0 := time.Now()
-	db.InsertUsers("INSERT INTO users(id,created,email,active) VALUES(?,?,?,?)", users)
-	insertMillis := millisSince(t0)
+	m := startMeter()
+	err = db.InsertUsers(ctx, "INSERT INTO users(id,created,email,active) VALUES(?,?,?,?)", users)
+	insert := m.stop()
+	if err != nil {
+		return failed("insert", err)
+	}
 	if verbose {
-		log.Printf("  insert took %d ms", insertMillis)
+		log.Printf("  insert took %s", insert.elapsed)
 	}
 	// query users
-	t0 = time.Now()
-	users = db.FindUsers("SELECT id,created,email,active FROM users ORDER BY id")
-	MustBeEqual(len(users), nusers)
-	queryMillis := millisSince(t0)
+	m = startMeter()
+	users, err = db.FindUsers(ctx, "SELECT id,created,email,active FROM users ORDER BY id")
+	query := m.stop()
+	if err != nil {
+		return failed("query", err)
+	}
 	if verbose {
-		log.Printf("  query took %d ms", queryMillis)
+		log.Printf("  query took %s", query.elapsed)
 	}
 	// validate query result
-	for i, u := range users {
-		MustBeEqual(i+1, u.Id)
-		Must(2023 <= u.Created.Year() && u.Created.Year() <= 2025, "wrong created year in %v", u.Created)
-		MustBeEqual("user0", u.Email[0:5])
-		MustBeEqual(true, u.Active)
+	err = checkUsers(users, nusers, base.Add(time.Duration(nusers)*time.Minute).Year(), "user0", alwaysActive)
+	if err != nil {
+		return failed("query", err)
 	}
-	// print results
-	bench := "1_simple"
-	log.Printf("%s - insert - %-10s - %10d", bench, db.DriverName(), insertMillis)
-	log.Printf("%s - query  - %-10s - %10d", bench, db.DriverName(), queryMillis)
-	log.Printf("%s - dbsize - %-10s - %10d", bench, db.DriverName(), dbsize(dbfile))
+	// scan users without collecting them
+	m = startMeter()
+	err = scanUsers(ctx, db, "SELECT id,created,email,active FROM users ORDER BY id", nusers)
+	scan := m.stop()
+	if err != nil {
+		return failed("scan", err)
+	}
+	if verbose {
+		log.Printf("  scan took %s", scan.elapsed)
+	}
+	return result{phases: []phase{{"insert", insert, nusers, nil}, {"query", query, nusers, nil}, {"scan", scan, nusers, nil}}, dbsize: dbsize(dbfile)}
 }
 
 // Insert 200 users in one database transaction.
 // Then insert 20000 articles (100 articles for each user) in another transaction.
 // Then insert 400000 articles (20 comments for each article) in another transaction.
 // Then query all users, articles and comments in one big JOIN statement.
-func benchComplex(dbfile string, verbose bool, makeDb func(dbfile string) Db) {
-	removeDbfiles(dbfile)
-	db := makeDb(dbfile)
+// Then scan the same JOIN statement without collecting the rows.
+func benchComplex(ctx context.Context, dbfile string, p pragmas, verbose bool, makeDb func(dbfile string) (Db, error)) result {
+	db, err := openDb(ctx, dbfile, p, makeDb)
+	if err != nil {
+		return failed("setup", err)
+	}
 	defer db.Close()
-	initSchema(db)
 	const nusers = 200
 	const narticlesPerUser = 100
 	const ncommentsPerArticle = 20
@@ -191,13 +525,20 @@ func benchComplex(dbfile string, verbose bool, makeDb func(dbfile string) Db) {
 		}
 	}
 	// insert users, articles, comments
-	t0 := time.Now()
-	db.InsertUsers(insertUserSql, users)
-	db.InsertArticles(insertArticleSql, articles)
-	db.InsertComments(insertCommentSql, comments)
-	insertMillis := millisSince(t0)
+	m := startMeter()
+	err = db.InsertUsers(ctx, insertUserSql, users)
+	if err == nil {
+		err = db.InsertArticles(ctx, insertArticleSql, articles)
+	}
+	if err == nil {
+		err = db.InsertComments(ctx, insertCommentSql, comments)
+	}
+	insert := m.stop()
+	if err != nil {
+		return failed("insert", err)
+	}
 	if verbose {
-		log.Printf("  insert took %d ms", insertMillis)
+		log.Printf("  insert took %s", insert.elapsed)
 	}
 	// query users, articles, comments in one big join
 	querySql := "SELECT" +
@@ -208,59 +549,56 @@ func benchComplex(dbfile string, verbose bool, makeDb func(dbfile string) Db) {
 		" LEFT JOIN articles ON articles.userId = users.id" +
 		" LEFT JOIN comments ON comments.articleId = articles.id" +
 		" ORDER BY users.created,  articles.created, comments.created"
-	t0 = time.Now()
-	users, articles, comments = db.FindUsersArticlesComments(querySql)
-	queryMillis := millisSince(t0)
+	m = startMeter()
+	users, articles, comments, err = db.FindUsersArticlesComments(ctx, querySql)
+	query := m.stop()
+	if err != nil {
+		return failed("query", err)
+	}
 	if verbose {
-		log.Printf("  query took %d ms", queryMillis)
+		log.Printf("  query took %s", query.elapsed)
 	}
 	// validate query result
-	MustBeEqual(nusers, len(users))
-	MustBeEqual(nusers*narticlesPerUser, len(articles))
-	MustBeEqual(nusers*narticlesPerUser*ncommentsPerArticle, len(comments))
-	for i, user := range users {
-		MustBeEqual(i+1, user.Id)
-		MustBeEqual(2023, user.Created.Year())
-		MustBeEqual("user0", user.Email[0:5])
-		MustBeEqual(i%2 == 0, user.Active)
-	}
-	for i, article := range articles {
-		MustBeEqual(i+1, article.Id)
-		MustBeEqual(2023, article.Created.Year())
-		MustBe(article.UserId >= 1)
-		MustBe(article.UserId <= 1+nusers)
-		MustBeEqual("article text", article.Text)
-		if i > 0 {
-			last := articles[i-1]
-			MustBe(article.UserId >= last.UserId)
-		}
-	}
-	for i, comment := range comments {
-		MustBeEqual(i+1, comment.Id)
-		MustBeEqual(2023, comment.Created.Year())
-		MustBe(comment.ArticleId >= 1)
-		MustBe(comment.ArticleId <= 1+(nusers*narticlesPerUser))
-		MustBeEqual("comment text", comment.Text)
-		if i > 0 {
-			last := comments[i-1]
-			MustBe(comment.ArticleId >= last.ArticleId)
-		}
-	}
-	// print results
-	bench := "2_complex"
-	log.Printf("%s - insert - %-10s - %10d", bench, db.DriverName(), insertMillis)
-	log.Printf("%s - query  - %-10s - %10d", bench, db.DriverName(), queryMillis)
-	log.Printf("%s - dbsize - %-10s - %10d", bench, db.DriverName(), dbsize(dbfile))
+	err = checkUsers(users, nusers, base.Add(time.Duration(nusers)*time.Minute).Year(), "user0", func(i int) bool { return i%2 == 0 })
+	if err == nil {
+		err = checkArticles(articles, nusers*narticlesPerUser, nusers)
+	}
+	if err == nil {
+		err = checkComments(comments, nusers*narticlesPerUser*ncommentsPerArticle, nusers*narticlesPerUser)
+	}
+	if err != nil {
+		return failed("query", err)
+	}
+	// scan users, articles, comments without collecting them
+	m = startMeter()
+	var nrows int
+	err = db.ScanUsersArticlesComments(ctx, querySql, func(User, Article, Comment) error {
+		nrows++
+		return nil
+	})
+	scan := m.stop()
+	if err == nil && nrows != len(comments) {
+		err = fmt.Errorf("want %d rows but got %d", len(comments), nrows)
+	}
+	if err != nil {
+		return failed("scan", err)
+	}
+	if verbose {
+		log.Printf("  scan took %s", scan.elapsed)
+	}
+	return result{phases: []phase{{"insert", insert, len(users) + len(articles) + len(comments), nil}, {"query", query, len(comments), nil}, {"scan", scan, nrows, nil}}, dbsize: dbsize(dbfile)}
 }
 
 // Insert N users in one database transaction.
 // Then query all users 1000 times.
+// Then scan all users 1000 times without collecting them.
 // This benchmark is used to simluate a read-heavy use case.
-func benchMany(dbfile string, verbose bool, nusers int, makeDb func(dbfile string) Db) {
-	removeDbfiles(dbfile)
-	db := makeDb(dbfile)
+func benchMany(ctx context.Context, dbfile string, p pragmas, verbose bool, nusers int, makeDb func(dbfile string) (Db, error)) result {
+	db, err := openDb(ctx, dbfile, p, makeDb)
+	if err != nil {
+		return failed("setup", err)
+	}
 	defer db.Close()
-	initSchema(db)
 	// insert users
 	var users []User
 	base := time.Date(2023, 10, 1, 10, 0, 0, 0, time.Local)
@@ -272,46 +610,61 @@ func benchMany(dbfile string, verbose bool, nusers int, makeDb func(dbfile strin
 			true,                                     // active,
 		))
 	}
-	t0 := time.Now()
-	db.InsertUsers(insertUserSql, users)
-	insertMillis := millisSince(t0)
+	m := startMeter()
+	err = db.InsertUsers(ctx, insertUserSql, users)
+	insert := m.stop()
+	if err != nil {
+		return failed("insert", err)
+	}
 	if verbose {
-		log.Printf("  insert took %d ms", insertMillis)
+		log.Printf("  insert took %s", insert.elapsed)
 	}
 	// query users 1000 times
-	t0 = time.Now()
-	for i := 0; i < 1000; i++ {
-		users = db.FindUsers("SELECT id,created,email,active FROM users ORDER BY id")
-		MustBeEqual(len(users), nusers)
+	m = startMeter()
+	for i := 0; i < 1000 && err == nil; i++ {
+		users, err = db.FindUsers(ctx, "SELECT id,created,email,active FROM users ORDER BY id")
+		if err == nil && len(users) != nusers {
+			err = fmt.Errorf("want %d users but got %d", nusers, len(users))
+		}
+	}
+	query := m.stop()
+	if err != nil {
+		return failed("query", err)
 	}
-	queryMillis := millisSince(t0)
 	if verbose {
-		log.Printf("  query took %d ms", queryMillis)
+		log.Printf("  query took %s", query.elapsed)
 	}
 	// validate query result
-	for i, u := range users {
-		MustBeEqual(i+1, u.Id)
-		MustBeEqual(2023, u.Created.Year())
-		MustBeEqual("user0", u.Email[0:5])
-		MustBeEqual(true, u.Active)
+	err = checkUsers(users, nusers, base.Add(time.Duration(nusers)*time.Minute).Year(), "user0", alwaysActive)
+	if err != nil {
+		return failed("query", err)
+	}
+	// scan users 1000 times without collecting them
+	m = startMeter()
+	for i := 0; i < 1000 && err == nil; i++ {
+		err = scanUsers(ctx, db, "SELECT id,created,email,active FROM users ORDER BY id", nusers)
+	}
+	scan := m.stop()
+	if err != nil {
+		return failed("scan", err)
+	}
+	if verbose {
+		log.Printf("  scan took %s", scan.elapsed)
 	}
-	// print results
-	bench := fmt.Sprintf("3_many/%04d", nusers)
-	log.Printf("%s - insert - %-10s - %10d", bench, db.DriverName(), insertMillis)
-	log.Printf("%s - query  - %-10s - %10d", bench, db.DriverName(), queryMillis)
-	log.Printf("%s - dbsize - %-10s - %10d", bench, db.DriverName(), dbsize(dbfile))
+	return result{phases: []phase{{"insert", insert, nusers, nil}, {"query", query, 1000 * nusers, nil}, {"scan", scan, 1000 * nusers, nil}}, dbsize: dbsize(dbfile)}
 }
 
 // Insert 10000 users with N bytes of row content.
 // Then query all users.
+// Then scan all users without collecting them.
 // This benchmark is used to simluate reading of large (gigabytes) databases.
-func benchLarge(dbfile string, verbose bool, nsize int, makeDb func(dbfile string) Db) {
-	removeDbfiles(dbfile)
-	db := makeDb(dbfile)
+func benchLarge(ctx context.Context, dbfile string, p pragmas, verbose bool, nsize int, makeDb func(dbfile string) (Db, error)) result {
+	db, err := openDb(ctx, dbfile, p, makeDb)
+	if err != nil {
+		return failed("setup", err)
+	}
 	defer db.Close()
-	initSchema(db)
 	// insert user with large emails
-	t0 := time.Now()
 	base := time.Date(2023, 10, 1, 10, 0, 0, 0, time.Local)
 	const nusers = 10_000
 	var users []User
@@ -323,41 +676,50 @@ func benchLarge(dbfile string, verbose bool, nsize int, makeDb func(dbfile strin
 			true,                                   // Active
 		))
 	}
-	db.InsertUsers(insertUserSql, users)
-	insertMillis := millisSince(t0)
+	m := startMeter()
+	err = db.InsertUsers(ctx, insertUserSql, users)
+	insert := m.stop()
+	if err != nil {
+		return failed("insert", err)
+	}
 	// query users
-	t0 = time.Now()
-	users = db.FindUsers("SELECT id,created,email,active FROM users ORDER BY id")
-	MustBeEqual(len(users), nusers)
-	queryMillis := millisSince(t0)
+	m = startMeter()
+	users, err = db.FindUsers(ctx, "SELECT id,created,email,active FROM users ORDER BY id")
+	query := m.stop()
+	if err != nil {
+		return failed("query", err)
+	}
 	if verbose {
-		log.Printf("  query took %d ms", queryMillis)
+		log.Printf("  query took %s", query.elapsed)
 	}
 	// validate query result
-	for i, u := range users {
-		MustBeEqual(i+1, u.Id)
-		MustBeEqual(2023, u.Created.Year())
-		MustBeEqual("a", u.Email[0:1])
-		MustBeEqual(true, u.Active)
+	err = checkUsers(users, nusers, base.Add(time.Duration(nusers)*time.Second).Year(), "a", alwaysActive)
+	if err != nil {
+		return failed("query", err)
 	}
-	// print results
-	bench := fmt.Sprintf("4_large/%06d", nsize)
-	log.Printf("%s - insert - %-10s - %10d", bench, db.DriverName(), insertMillis)
-	log.Printf("%s - query  - %-10s - %10d", bench, db.DriverName(), queryMillis)
-	log.Printf("%s - dbsize - %-10s - %10d", bench, db.DriverName(), dbsize(dbfile))
+	// scan users without collecting them
+	m = startMeter()
+	err = scanUsers(ctx, db, "SELECT id,created,email,active FROM users ORDER BY id", nusers)
+	scan := m.stop()
+	if err != nil {
+		return failed("scan", err)
+	}
+	if verbose {
+		log.Printf("  scan took %s", scan.elapsed)
+	}
+	return result{phases: []phase{{"insert", insert, nusers, nil}, {"query", query, nusers, nil}, {"scan", scan, nusers, nil}}, dbsize: dbsize(dbfile)}
 }
 
-// Insert one million users.
+// Insert one million (see -users) users.
 // Then have N goroutines query all users.
 // This benchmark is used to simulate concurrent reads.
-func benchConcurrent(dbfile string, verbose bool, ngoroutines int, makeDb func(dbfile string) Db) {
-	removeDbfiles(dbfile)
-	db1 := makeDb(dbfile)
-	driverName := db1.DriverName()
-	initSchema(db1)
+func benchConcurrent(ctx context.Context, dbfile string, p pragmas, verbose bool, nusers int, ngoroutines int, makeDb func(dbfile string) (Db, error)) result {
+	db1, err := openDb(ctx, dbfile, p, makeDb)
+	if err != nil {
+		return failed("setup", err)
+	}
 	// insert many users
 	base := time.Date(2023, 10, 1, 10, 0, 0, 0, time.Local)
-	const nusers = 1_000_000
 	var users []User
 	for i := 0; i < nusers; i++ {
 		users = append(users, NewUser(
@@ -367,43 +729,525 @@ func benchConcurrent(dbfile string, verbose bool, ngoroutines int, makeDb func(d
 			true,                                   // Active
 		))
 	}
-	t0 := time.Now()
-	db1.InsertUsers(insertUserSql, users)
-	db1.Close()
-	insertMillis := millisSince(t0)
-	// query users in N goroutines
-	t0 = time.Now()
+	m := startMeter()
+	err = db1.InsertUsers(ctx, insertUserSql, users)
+	if err != nil {
+		db1.Close()
+	} else {
+		err = db1.Close()
+	}
+	insert := m.stop()
+	if err != nil {
+		return failed("insert", err)
+	}
+	maxYear := base.Add(time.Duration(nusers) * time.Second).Year()
+	// query users in N goroutines, each goroutine writes only its own span
+	m = startMeter()
+	spans := make([]span, ngoroutines)
 	var wg sync.WaitGroup
 	for i := 0; i < ngoroutines; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			db := makeDb(dbfile)
-			db.Exec(
-				"PRAGMA foreign_keys=1",
-				"PRAGMA busy_timeout=5000", // 5s busy timeout
-			)
-			defer db.Close()
-			users = db.FindUsers("SELECT id,created,email,active FROM users ORDER BY id")
-			MustBeEqual(len(users), nusers)
-			// validate query result
-			for i, u := range users {
-				MustBeEqual(i+1, u.Id)
-				MustBeEqual(2023, u.Created.Year())
-				MustBeEqual("user", u.Email[0:4])
-				MustBeEqual(true, u.Active)
-			}
+			spans[i] = queryConcurrent(ctx, dbfile, nusers, maxYear, makeDb)
 		}()
 	}
 	// wait for completion
 	wg.Wait()
-	queryMillis := millisSince(t0)
+	query := m.stop()
+	errs := make([]error, ngoroutines)
+	latencies := make([]float64, ngoroutines)
+	for i, s := range spans {
+		errs[i] = s.err
+		latencies[i] = float64(s.end.Sub(s.start).Nanoseconds())
+	}
+	if err := errors.Join(errs...); err != nil {
+		return failed("query", err)
+	}
+	st := newStats(latencies)
+	overlap := maxOverlap(spans)
+	if verbose {
+		log.Printf("  query took %s, %d of %d goroutines overlapped", query.elapsed, overlap, ngoroutines)
+	}
+	metrics := []metric{
+		{st.min, "latency-min-ns"},
+		{st.median, "latency-p50-ns"},
+		{st.max, "latency-max-ns"},
+		{float64(overlap), "overlap"},
+	}
+	return result{phases: []phase{{"insert", insert, nusers, nil}, {"query", query, ngoroutines * nusers, metrics}}, dbsize: dbsize(dbfile)}
+}
+
+// span is the time a goroutine of the concurrent benchmark spent on its
+// query, including opening and closing its connection.
+type span struct {
+	start time.Time
+	end   time.Time
+	err   error
+}
+
+// maxOverlap returns the maximum number of spans that were running at the
+// same time.
+func maxOverlap(spans []span) int {
+	type event struct {
+		t     time.Time
+		delta int
+	}
+	events := make([]event, 0, 2*len(spans))
+	for _, s := range spans {
+		events = append(events, event{s.start, 1}, event{s.end, -1})
+	}
+	// at equal times, ends sort before starts, so touching spans don't count
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].t.Equal(events[j].t) {
+			return events[i].delta < events[j].delta
+		}
+		return events[i].t.Before(events[j].t)
+	})
+	var n, most int
+	for _, e := range events {
+		n += e.delta
+		if n > most {
+			most = n
+		}
+	}
+	return most
+}
+
+// queryConcurrent opens its own database connection, queries all users and
+// validates them. It returns the time span of its work.
+func queryConcurrent(ctx context.Context, dbfile string, nusers int, maxYear int, makeDb func(dbfile string) (Db, error)) span {
+	s := span{start: time.Now()}
+	s.err = queryUsers(ctx, dbfile, nusers, maxYear, makeDb)
+	s.end = time.Now()
+	return s
+}
+
+func queryUsers(ctx context.Context, dbfile string, nusers int, maxYear int, makeDb func(dbfile string) (Db, error)) error {
+	db, err := makeDb(dbfile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	err = db.Exec(ctx,
+		"PRAGMA foreign_keys=1",
+		"PRAGMA busy_timeout=5000", // 5s busy timeout
+	)
+	if err != nil {
+		return err
+	}
+	users, err := db.FindUsers(ctx, "SELECT id,created,email,active FROM users ORDER BY id")
+	if err != nil {
+		return err
+	}
+	return checkUsers(users, nusers, maxYear, "user", alwaysActive)
+}
+
+// Start a query that takes seconds to run, and cancel it after a while
+// (see -cancel-after). Then measure how long it takes until the driver
+// returns. This benchmark is used to simulate request timeouts.
+func benchCancel(ctx context.Context, dbfile string, p pragmas, verbose bool, cancelAfter time.Duration, makeDb func(dbfile string) (Db, error)) result {
+	db, err := openDb(ctx, dbfile, p, makeDb)
+	if err != nil {
+		return failed("setup", err)
+	}
+	defer db.Close()
+	if _, ok := db.(uninterruptible); ok {
+		return unsupported("driver cannot interrupt a running statement")
+	}
+	// count to 10 million without returning a row
+	const querySql = "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 10000000)" +
+		" SELECT x, 0, '', 0 FROM c WHERE x < 0"
+	queryCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := db.FindUsers(queryCtx, querySql)
+		done <- err
+	}()
+	time.Sleep(cancelAfter)
+	m := startMeter()
+	cancel()
+	err = <-done
+	latency := m.stop()
+	if verbose {
+		log.Printf("  cancel took %s, error %v", latency.elapsed, err)
+	}
+	// a query that returns no error has run to completion, any error other
+	// than an interruption is a failure
+	var cancelled float64
+	if err != nil {
+		if queryCtx.Err() == nil || !isInterrupt(db, err) {
+			return failed("cancel", err)
+		}
+		cancelled = 1
+	}
+	return result{phases: []phase{{"cancel", latency, 0, []metric{{cancelled, "cancelled"}}}}, dbsize: dbsize(dbfile)}
+}
+
+// isInterrupt tells whether err is the error of an interrupted statement.
+// Drivers return either the error of the cancelled context or SQLite's
+// SQLITE_INTERRUPT result code.
+func isInterrupt(db Db, err error) bool {
+	return errors.Is(err, context.Canceled) || db.IsInterrupt(err)
+}
+
+// Insert one million (see -users) users.
+// Then look up 200000 (see -lookups) random users by primary key, one
+// query per user, with a prepared statement that is reused for all lookups.
+// This benchmark is used to simulate web handlers that load single rows.
+func benchLookup(ctx context.Context, dbfile string, p pragmas, verbose bool, nusers int, nlookups int, makeDb func(dbfile string) (Db, error)) result {
+	db, err := openDb(ctx, dbfile, p, makeDb)
+	if err != nil {
+		return failed("setup", err)
+	}
+	defer db.Close()
+	// insert users
+	var users []User
+	base := time.Date(2023, 10, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < nusers; i++ {
+		users = append(users, NewUser(
+			i+1,                                      // id,
+			base.Add(time.Duration(i)*time.Minute),   // created,
+			fmt.Sprintf("user%08d@example.com", i+1), // email,
+			true,                                     // active,
+		))
+	}
+	m := startMeter()
+	err = db.InsertUsers(ctx, insertUserSql, users)
+	insert := m.stop()
+	if err != nil {
+		return failed("insert", err)
+	}
+	if verbose {
+		log.Printf("  insert took %s", insert.elapsed)
+	}
+	// random ids, seeded so that all drivers look up the same users
+	rnd := rand.New(rand.NewSource(1))
+	ids := make([]int, nlookups)
+	for i := range ids {
+		ids[i] = 1 + rnd.Intn(nusers)
+	}
+	// look up users, the latency of a lookup is the time since the
+	// previous one returned. The first lookup includes preparing the
+	// statement, so it has no latency sample.
+	var nfound int
+	latencies := make([]float64, 0, nlookups-1)
+	m = startMeter()
+	var t0 time.Time
+	err = db.FindUsersById(ctx, "SELECT id,created,email,active FROM users WHERE id = ?", ids, func(user User) error {
+		t := time.Now()
+		if nfound > 0 {
+			latencies = append(latencies, float64(t.Sub(t0).Nanoseconds()))
+		}
+		t0 = t
+		i := nfound
+		nfound++
+		if i >= len(ids) {
+			return fmt.Errorf("found more users than ids")
+		}
+		if user.Id != ids[i] {
+			return fmt.Errorf("lookup %d: got user %d, want %d", i, user.Id, ids[i])
+		}
+		return nil
+	})
+	lookup := m.stop()
+	if err == nil && nfound != nlookups {
+		err = fmt.Errorf("found %d users, want %d", nfound, nlookups)
+	}
+	if err != nil {
+		return failed("lookup", err)
+	}
+	if verbose {
+		log.Printf("  lookup took %s", lookup.elapsed)
+	}
+	sort.Float64s(latencies)
+	metrics := []metric{
+		{float64(nlookups) / lookup.elapsed.Seconds(), "lookups/s"},
+		{percentile(latencies, 50), "latency-p50-ns"},
+		{percentile(latencies, 95), "latency-p95-ns"},
+		{percentile(latencies, 99), "latency-p99-ns"},
+		{latencies[len(latencies)-1], "latency-max-ns"},
+	}
+	return result{phases: []phase{{"insert", insert, nusers, nil}, {"lookup", lookup, nlookups, metrics}}, dbsize: dbsize(dbfile)}
+}
+
+// Insert 10000 users, 10 articles for each user and 5 comments for each
+// article. Then update all users in transactions of 1000 rows: created,
+// email and active are changed. Then delete every second article and its
+// comments in transactions of 1000 rows, comments first, since foreign keys
+// are enforced.
+// This benchmark is used to simulate write workloads that modify existing
+// rows and have to maintain indexes and check foreign keys.
+func benchUpdate(ctx context.Context, dbfile string, p pragmas, verbose bool, makeDb func(dbfile string) (Db, error)) result {
+	db, err := openDb(ctx, dbfile, p, makeDb)
+	if err != nil {
+		return failed("setup", err)
+	}
+	defer db.Close()
+	const nusers = 10_000
+	const narticlesPerUser = 10
+	const ncommentsPerArticle = 5
+	const batchSize = 1000
+	// make users, articles, comments
+	var users []User
+	var articles []Article
+	var comments []Comment
+	base := time.Date(2023, 10, 1, 10, 0, 0, 0, time.Local)
+	for u := 0; u < nusers; u++ {
+		userId := u + 1
+		created := base.Add(time.Duration(u) * time.Minute)
+		users = append(users, NewUser(userId, created, fmt.Sprintf("user%08d@example.com", userId), true))
+		for a := 0; a < narticlesPerUser; a++ {
+			articleId := len(articles) + 1
+			articles = append(articles, NewArticle(articleId, created.Add(time.Duration(a)*time.Second), userId, "article text"))
+			for c := 0; c < ncommentsPerArticle; c++ {
+				commentId := len(comments) + 1
+				comments = append(comments, NewComment(commentId, created.Add(time.Duration(a)*time.Second).Add(time.Duration(c)*time.Millisecond), articleId, "comment text"))
+			}
+		}
+	}
+	// insert users, articles, comments
+	m := startMeter()
+	err = db.InsertUsers(ctx, insertUserSql, users)
+	if err == nil {
+		err = db.InsertArticles(ctx, insertArticleSql, articles)
+	}
+	if err == nil {
+		err = db.InsertComments(ctx, insertCommentSql, comments)
+	}
+	insert := m.stop()
+	if err != nil {
+		return failed("insert", err)
+	}
+	if verbose {
+		log.Printf("  insert took %s", insert.elapsed)
+	}
+	// update users, one year later, with a new email, and every second
+	// user inactive
+	for i := range users {
+		users[i] = NewUser(users[i].Id, users[i].Created.AddDate(1, 0, 0), fmt.Sprintf("updated%08d@example.com", users[i].Id), i%2 == 0)
+	}
+	m = startMeter()
+	for i := 0; i < len(users) && err == nil; i += batchSize {
+		err = db.UpdateUsers(ctx, "UPDATE users SET created=?, email=?, active=? WHERE id=?", users[i:min(i+batchSize, len(users))])
+	}
+	update := m.stop()
+	if err != nil {
+		return failed("update", err)
+	}
+	if verbose {
+		log.Printf("  update took %s", update.elapsed)
+	}
+	// delete even articles and their comments
+	var articleIds, commentIds []int
+	for _, a := range articles {
+		if a.Id%2 == 0 {
+			articleIds = append(articleIds, a.Id)
+		}
+	}
+	for _, c := range comments {
+		if c.ArticleId%2 == 0 {
+			commentIds = append(commentIds, c.Id)
+		}
+	}
+	m = startMeter()
+	for i := 0; i < len(commentIds) && err == nil; i += batchSize {
+		err = db.DeleteByIds(ctx, "DELETE FROM comments WHERE id=?", commentIds[i:min(i+batchSize, len(commentIds))])
+	}
+	for i := 0; i < len(articleIds) && err == nil; i += batchSize {
+		err = db.DeleteByIds(ctx, "DELETE FROM articles WHERE id=?", articleIds[i:min(i+batchSize, len(articleIds))])
+	}
+	del := m.stop()
+	if err != nil {
+		return failed("delete", err)
+	}
+	if verbose {
+		log.Printf("  delete took %s", del.elapsed)
+	}
+	// validate remaining rows
+	users, err = db.FindUsers(ctx, "SELECT id,created,email,active FROM users ORDER BY id")
+	if err == nil {
+		err = checkUsers(users, nusers, base.AddDate(1, 0, 0).Add(time.Duration(nusers)*time.Minute).Year(), "updated", func(i int) bool { return i%2 == 0 })
+	}
+	if err == nil {
+		err = checkRemaining(ctx, db, len(articles)-len(articleIds), len(comments)-len(commentIds))
+	}
+	if err != nil {
+		return failed("delete", err)
+	}
+	nrows := len(articleIds) + len(commentIds)
+	return result{phases: []phase{{"insert", insert, len(users) + len(articles) + len(comments), nil}, {"update", update, len(users), nil}, {"delete", del, nrows, nil}}, dbsize: dbsize(dbfile)}
+}
+
+// checkRemaining validates the articles and comments that are left after
+// the update benchmark deleted every second article: there must be
+// narticles articles with odd ids and ncomments comments of these articles.
+func checkRemaining(ctx context.Context, db Db, narticles int, ncomments int) error {
+	querySql := "SELECT" +
+		" users.id, users.created, users.email, users.active," +
+		" articles.id, articles.created, articles.userId, articles.text," +
+		" comments.id, comments.created, comments.articleId, comments.text" +
+		" FROM comments" +
+		" JOIN articles ON articles.id = comments.articleId" +
+		" JOIN users ON users.id = articles.userId" +
+		" ORDER BY comments.id"
+	articleIds := make(map[int]bool)
+	var n int
+	err := db.ScanUsersArticlesComments(ctx, querySql, func(u User, a Article, c Comment) error {
+		if a.Id%2 == 0 {
+			return fmt.Errorf("comment %d: article %d was deleted", c.Id, a.Id)
+		}
+		articleIds[a.Id] = true
+		n++
+		return nil
+	})
+	switch {
+	case err != nil:
+		return err
+	case n != ncomments:
+		return fmt.Errorf("want %d comments but got %d", ncomments, n)
+	case len(articleIds) != narticles:
+		return fmt.Errorf("want %d articles but got %d", narticles, len(articleIds))
+	}
+	return nil
+}
+
+// Insert one million (see -users) users, like the simple benchmark.
+// Then upsert one million users, of which the first half already exist:
+// existing users get a new email, the others are inserted.
+// This benchmark is used to simulate ingestion jobs that upsert rows.
+func benchUpsert(ctx context.Context, dbfile string, p pragmas, verbose bool, nusers int, makeDb func(dbfile string) (Db, error)) result {
+	db, err := openDb(ctx, dbfile, p, makeDb)
+	if err != nil {
+		return failed("setup", err)
+	}
+	defer db.Close()
+	// insert users
+	var users []User
+	base := time.Date(2023, 10, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < nusers; i++ {
+		users = append(users, NewUser(
+			i+1,                                      // id,
+			base.Add(time.Duration(i)*time.Minute),   // created,
+			fmt.Sprintf("user%08d@example.com", i+1), // email,
+			true,                                     // active,
+		))
+	}
+	m := startMeter()
+	err = db.InsertUsers(ctx, insertUserSql, users)
+	insert := m.stop()
+	if err != nil {
+		return failed("insert", err)
+	}
+	if verbose {
+		log.Printf("  insert took %s", insert.elapsed)
+	}
+	// upsert users, starting in the middle of the existing ones
+	offset := nusers / 2
+	users = users[:0]
+	for i := offset; i < offset+nusers; i++ {
+		users = append(users, NewUser(
+			i+1,                                      // id,
+			base.Add(time.Duration(i)*time.Minute),   // created,
+			fmt.Sprintf("user%08d@example.org", i+1), // email,
+			true,                                     // active,
+		))
+	}
+	upsertSql := insertUserSql + " ON CONFLICT(id) DO UPDATE SET email=excluded.email"
+	m = startMeter()
+	err = db.InsertUsers(ctx, upsertSql, users)
+	upsert := m.stop()
+	if err != nil {
+		return failed("upsert", err)
+	}
+	if verbose {
+		log.Printf("  upsert took %s", upsert.elapsed)
+	}
+	// validate users, the upserted ones have the new email
+	users, err = db.FindUsers(ctx, "SELECT id,created,email,active FROM users ORDER BY id")
+	if err == nil {
+		err = checkUsers(users, offset+nusers, base.Add(time.Duration(offset+nusers)*time.Minute).Year(), "user", alwaysActive)
+	}
+	if err == nil {
+		for _, u := range users {
+			if u.Id > offset && !strings.HasSuffix(u.Email, ".org") {
+				err = fmt.Errorf("user %d: email %q was not upserted", u.Id, u.Email)
+				break
+			}
+			if u.Id <= offset && !strings.HasSuffix(u.Email, ".com") {
+				err = fmt.Errorf("user %d: email %q was changed", u.Id, u.Email)
+				break
+			}
+		}
+	}
+	if err != nil {
+		return failed("upsert", err)
+	}
+	return result{phases: []phase{{"insert", insert, nusers, nil}, {"upsert", upsert, nusers, nil}}, dbsize: dbsize(dbfile)}
+}
+
+// Insert 10000 users in transactions of N rows each, that is 10000/N
+// transactions.
+// This benchmark is used to simulate applications that write a few rows
+// per request, where the cost of a transaction dominates.
+func benchBatch(ctx context.Context, dbfile string, p pragmas, verbose bool, batchSize int, makeDb func(dbfile string) (Db, error)) result {
+	db, err := openDb(ctx, dbfile, p, makeDb)
+	if err != nil {
+		return failed("setup", err)
+	}
+	defer db.Close()
+	const nusers = 10_000
+	var users []User
+	base := time.Date(2023, 10, 1, 10, 0, 0, 0, time.Local)
+	for i := 0; i < nusers; i++ {
+		users = append(users, NewUser(
+			i+1,                                      // id,
+			base.Add(time.Duration(i)*time.Minute),   // created,
+			fmt.Sprintf("user%08d@example.com", i+1), // email,
+			true,                                     // active,
+		))
+	}
+	// batch size 0 inserts each user with a plain statement outside of any
+	// explicit transaction, so that sqlite commits every row on its own
+	var autocommitSqls []string
+	if batchSize == 0 {
+		for _, u := range users {
+			autocommitSqls = append(autocommitSqls, fmt.Sprintf(
+				"INSERT INTO users(id,created,email,active) VALUES(%d,%d,'%s',1)",
+				u.Id, BindTime(u.Created), u.Email,
+			))
+		}
+	}
+	// insert users, one transaction per batch
+	var ntx int
+	m := startMeter()
+	if batchSize == 0 {
+		for i := 0; i < nusers && err == nil; i++ {
+			err = db.Exec(ctx, autocommitSqls[i])
+			ntx++
+		}
+	} else {
+		for i := 0; i < nusers && err == nil; i += batchSize {
+			err = db.InsertUsers(ctx, insertUserSql, users[i:min(i+batchSize, nusers)])
+			ntx++
+		}
+	}
+	insert := m.stop()
+	if err != nil {
+		return failed("insert", err)
+	}
 	if verbose {
-		log.Printf("  query took %d ms", queryMillis)
+		log.Printf("  insert took %s in %d transactions", insert.elapsed, ntx)
+	}
+	// validate users
+	users, err = db.FindUsers(ctx, "SELECT id,created,email,active FROM users ORDER BY id")
+	if err == nil {
+		err = checkUsers(users, nusers, base.Add(time.Duration(nusers)*time.Minute).Year(), "user0", alwaysActive)
+	}
+	if err != nil {
+		return failed("query", err)
 	}
-	// print results
-	bench := fmt.Sprintf("5_concurrent/%d", ngoroutines)
-	log.Printf("%s - insert - %-10s - %10d", bench, driverName, insertMillis)
-	log.Printf("%s - query  - %-10s - %10d", bench, driverName, queryMillis)
-	log.Printf("%s - dbsize - %-10s - %10d", bench, driverName, dbsize(dbfile))
+	metrics := []metric{{perRow(insert.elapsed, ntx), "ns/tx"}}
+	return result{phases: []phase{{"insert", insert, nusers, metrics}}, dbsize: dbsize(dbfile)}
 }
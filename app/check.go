@@ -0,0 +1,82 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkUsers validates the users returned by a query: there must be nusers
+// users with consecutive ids starting at 1, ordered by id, created in the
+// years 2023 to maxYear, with an email that starts with emailPrefix and
+// with the active flag of active(i).
+func checkUsers(users []User, nusers int, maxYear int, emailPrefix string, active func(i int) bool) error {
+	if len(users) != nusers {
+		return fmt.Errorf("want %d users but got %d", nusers, len(users))
+	}
+	for i, u := range users {
+		switch {
+		case u.Id != i+1:
+			return fmt.Errorf("user %d: want id %d but got %d", i, i+1, u.Id)
+		case u.Created.Year() < 2023 || u.Created.Year() > maxYear:
+			return fmt.Errorf("user %d: wrong created year in %v", u.Id, u.Created)
+		case !strings.HasPrefix(u.Email, emailPrefix):
+			return fmt.Errorf("user %d: want email prefix %q but got %q", u.Id, emailPrefix, u.Email)
+		case u.Active != active(i):
+			return fmt.Errorf("user %d: want active %t but got %t", u.Id, active(i), u.Active)
+		}
+	}
+	return nil
+}
+
+// alwaysActive is the active flag of users that are all active.
+func alwaysActive(int) bool {
+	return true
+}
+
+// checkArticles validates the articles returned by the complex query:
+// there must be narticles articles with consecutive ids starting at 1,
+// written in 2023 by one of nusers users, ordered by user.
+func checkArticles(articles []Article, narticles int, nusers int) error {
+	if len(articles) != narticles {
+		return fmt.Errorf("want %d articles but got %d", narticles, len(articles))
+	}
+	for i, a := range articles {
+		switch {
+		case a.Id != i+1:
+			return fmt.Errorf("article %d: want id %d but got %d", i, i+1, a.Id)
+		case a.Created.Year() != 2023:
+			return fmt.Errorf("article %d: wrong created year in %v", a.Id, a.Created)
+		case a.UserId < 1 || a.UserId > 1+nusers:
+			return fmt.Errorf("article %d: wrong userId %d", a.Id, a.UserId)
+		case a.Text != "article text":
+			return fmt.Errorf("article %d: wrong text %q", a.Id, a.Text)
+		case i > 0 && a.UserId < articles[i-1].UserId:
+			return fmt.Errorf("article %d: not ordered by userId", a.Id)
+		}
+	}
+	return nil
+}
+
+// checkComments validates the comments returned by the complex query:
+// there must be ncomments comments with consecutive ids starting at 1,
+// written in 2023 for one of narticles articles, ordered by article.
+func checkComments(comments []Comment, ncomments int, narticles int) error {
+	if len(comments) != ncomments {
+		return fmt.Errorf("want %d comments but got %d", ncomments, len(comments))
+	}
+	for i, c := range comments {
+		switch {
+		case c.Id != i+1:
+			return fmt.Errorf("comment %d: want id %d but got %d", i, i+1, c.Id)
+		case c.Created.Year() != 2023:
+			return fmt.Errorf("comment %d: wrong created year in %v", c.Id, c.Created)
+		case c.ArticleId < 1 || c.ArticleId > 1+narticles:
+			return fmt.Errorf("comment %d: wrong articleId %d", c.Id, c.ArticleId)
+		case c.Text != "comment text":
+			return fmt.Errorf("comment %d: wrong text %q", c.Id, c.Text)
+		case i > 0 && c.ArticleId < comments[i-1].ArticleId:
+			return fmt.Errorf("comment %d: not ordered by articleId", c.Id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userHZ is the unit of the CPU times in /proc/<pid>/stat. It is 100 on
+// all Linux architectures that Go supports.
+const userHZ = 100
+
+// liveChildren returns the pids of the running child processes of the
+// current process, as listed in /proc/self/task/<tid>/children.
+func liveChildren() []int {
+	files, _ := filepath.Glob("/proc/self/task/*/children")
+	var pids []int
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, field := range strings.Fields(string(data)) {
+			pid, err := strconv.Atoi(field)
+			if err == nil {
+				pids = append(pids, pid)
+			}
+		}
+	}
+	return pids
+}
+
+// readLiveRusage returns the resource usage of the running child processes,
+// which getrusage(2) does not report until they have terminated. The CPU
+// times are read from /proc/<pid>/stat, context switches and max RSS from
+// /proc/<pid>/status. Children that terminate while they are read are
+// skipped.
+func readLiveRusage() rusage {
+	var total rusage
+	for _, pid := range liveChildren() {
+		r, ok := readProcRusage(pid)
+		if ok {
+			total = total.plus(r)
+		}
+	}
+	return total
+}
+
+func readProcRusage(pid int) (rusage, bool) {
+	dir := "/proc/" + strconv.Itoa(pid)
+	stat, err := os.ReadFile(dir + "/stat")
+	if err != nil {
+		return rusage{}, false
+	}
+	// the command name in parentheses may contain spaces, the fields after
+	// it start with the state, field 3 in proc(5)
+	_, after, ok := strings.Cut(string(stat), ")")
+	if !ok {
+		return rusage{}, false
+	}
+	fields := strings.Fields(after)
+	if len(fields) < 13 {
+		return rusage{}, false
+	}
+	utime, err1 := strconv.ParseInt(fields[11], 10, 64) // field 14
+	stime, err2 := strconv.ParseInt(fields[12], 10, 64) // field 15
+	if err1 != nil || err2 != nil {
+		return rusage{}, false
+	}
+	r := rusage{
+		user: time.Duration(utime) * time.Second / userHZ,
+		sys:  time.Duration(stime) * time.Second / userHZ,
+	}
+	f, err := os.Open(dir + "/status")
+	if err != nil {
+		return rusage{}, false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		name, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "voluntary_ctxt_switches":
+			r.nvcsw = n
+		case "nonvoluntary_ctxt_switches":
+			r.nivcsw = n
+		case "VmHWM":
+			r.maxrss = n * 1024
+		}
+	}
+	return r, sc.Err() == nil
+}
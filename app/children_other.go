@@ -0,0 +1,9 @@
+//go:build !linux
+
+package app
+
+// readLiveRusage is not supported on this platform and returns zero usage,
+// running child processes are accounted for only after they terminated.
+func readLiveRusage() rusage {
+	return rusage{}
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// TestBenchConcurrent runs the concurrent benchmark against a real database,
+// run it with -race to check that the goroutines share no state.
+func TestBenchConcurrent(t *testing.T) {
+	dbfile := filepath.Join(t.TempDir(), "bench.db")
+	makeDb := func(dbfile string) (Db, error) {
+		db, err := sql.Open("sqlite", dbfile)
+		if err != nil {
+			return nil, err
+		}
+		return NewSqlDb("modernc", db, func(error) bool { return false }), nil
+	}
+	const nusers, ngoroutines = 100, 4
+	p := pragmas{DefaultJournalMode, DefaultSynchronous}
+	res := benchConcurrent(context.Background(), dbfile, p, false, nusers, ngoroutines, makeDb)
+	if res.err != nil {
+		t.Fatalf("%s failed: %s", res.errPhase, res.err)
+	}
+	if len(res.phases) != 2 {
+		t.Fatalf("want 2 phases, got %d", len(res.phases))
+	}
+	query := res.phases[1]
+	if query.name != "query" || query.nrows != nusers*ngoroutines {
+		t.Fatalf("want query phase with %d rows, got %s with %d", nusers*ngoroutines, query.name, query.nrows)
+	}
+	metrics := make(map[string]float64)
+	for _, m := range query.metrics {
+		metrics[m.unit] = m.value
+	}
+	if o := metrics["overlap"]; o < 1 || o > ngoroutines {
+		t.Fatalf("want overlap in 1..%d, got %g", ngoroutines, o)
+	}
+	if metrics["latency-min-ns"] <= 0 || metrics["latency-min-ns"] > metrics["latency-max-ns"] {
+		t.Fatalf("invalid latencies %v", metrics)
+	}
+}
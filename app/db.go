@@ -1,17 +1,49 @@
 package app
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
-// Db is the database interface.
+// Db is the database interface. Methods return an error instead of
+// panicking, so that a failing driver does not abort the whole run.
+// If ctx is cancelled, methods should interrupt the running statement and
+// return an error as soon as possible.
 type Db interface {
 	DriverName() string
-	Exec(sqls ...string)
-	InsertUsers(insertSql string, users []User)
-	InsertArticles(insertSql string, articles []Article)
-	InsertComments(insertSql string, comments []Comment)
-	FindUsers(querySql string) []User
-	FindUsersArticlesComments(querySql string) ([]User, []Article, []Comment)
-	Close()
+	SqliteVersion(ctx context.Context) (string, error)    // result of sqlite_version()
+	CompileOptions(ctx context.Context) ([]string, error) // result of PRAGMA compile_options
+	Exec(ctx context.Context, sqls ...string) error
+	InsertUsers(ctx context.Context, insertSql string, users []User) error
+	InsertArticles(ctx context.Context, insertSql string, articles []Article) error
+	InsertComments(ctx context.Context, insertSql string, comments []Comment) error
+	// UpdateUsers runs updateSql for all users in one transaction, binding
+	// created, email, active and id of each user in that order.
+	UpdateUsers(ctx context.Context, updateSql string, users []User) error
+	// DeleteByIds runs deleteSql for all ids in one transaction.
+	DeleteByIds(ctx context.Context, deleteSql string, ids []int) error
+	FindUsers(ctx context.Context, querySql string) ([]User, error)
+	FindUsersArticlesComments(ctx context.Context, querySql string) ([]User, []Article, []Comment, error)
+	// ScanUsers and ScanUsersArticlesComments call fn for each row instead
+	// of collecting all rows. They stop and return the error if fn fails.
+	ScanUsers(ctx context.Context, querySql string, fn func(User) error) error
+	ScanUsersArticlesComments(ctx context.Context, querySql string, fn func(User, Article, Comment) error) error
+	// FindUsersById prepares querySql, which selects a user by its id, once
+	// and runs it for each id in ids, calling fn with each user found.
+	FindUsersById(ctx context.Context, querySql string, ids []int, fn func(User) error) error
+	// IsInterrupt tells whether err has SQLite's SQLITE_INTERRUPT result
+	// code, as returned for a statement that was interrupted because ctx
+	// was cancelled.
+	IsInterrupt(err error) bool
+	Close() error
+}
+
+// uninterruptible is implemented by a Db whose driver has no way to
+// interrupt a running statement. Benchmarks that measure interruption
+// report such a driver as unsupported instead of timing a statement that
+// runs to completion.
+type uninterruptible interface {
+	CannotInterrupt()
 }
 
 // User is a registered User who can access the blog.
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// DriverModules maps driver names to their Go module paths.
+var DriverModules = map[string]string{
+	"craw":    "crawshaw.io/sqlite",
+	"eaton":   "github.com/eatonphil/gosqlite",
+	"mattn":   "github.com/mattn/go-sqlite3",
+	"modernc": "modernc.org/sqlite",
+	"ncruces": "github.com/ncruces/go-sqlite3",
+	"sqinn":   "github.com/cvilsmeier/sqinn-go",
+	"zombie":  "zombiezen.com/go/sqlite",
+}
+
+// Env describes the environment a benchmark binary runs in.
+// It is collected once per run and written as a header in every output
+// format, so that results can be attributed to hardware and versions.
+type Env struct {
+	Driver        string            `json:"driver"`
+	GoVersion     string            `json:"goVersion"`
+	GOOS          string            `json:"goos"`
+	GOARCH        string            `json:"goarch"`
+	GOMAXPROCS    int               `json:"gomaxprocs"`
+	CPU           string            `json:"cpu"`    // CPU model, "" if unknown
+	Kernel        string            `json:"kernel"` // kernel release, "" if unknown
+	DriverModule  string            `json:"driverModule"`
+	DriverVersion string            `json:"driverVersion"`
+	Modules       map[string]string `json:"modules"` // all linked modules, path to version
+	// The SQLite library bundled or used by the driver.
+	SqliteVersion  string   `json:"sqliteVersion"`
+	CompileOptions []string `json:"compileOptions"`
+}
+
+// readEnv collects the environment of the current process and the SQLite
+// library of db. If the SQLite library cannot be queried, the error is
+// logged and the SQLite fields are left empty.
+func readEnv(ctx context.Context, db Db) Env {
+	driver := db.DriverName()
+	env := Env{
+		Driver:       driver,
+		GoVersion:    runtime.Version(),
+		GOOS:         runtime.GOOS,
+		GOARCH:       runtime.GOARCH,
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		CPU:          readCPUModel(),
+		Kernel:       readKernel(),
+		DriverModule: DriverModules[driver],
+		Modules:      make(map[string]string),
+	}
+	var err error
+	env.SqliteVersion, err = db.SqliteVersion(ctx)
+	if err != nil {
+		log.Printf("cannot read sqlite version: %s", err)
+	}
+	env.CompileOptions, err = db.CompileOptions(ctx)
+	if err != nil {
+		log.Printf("cannot read sqlite compile options: %s", err)
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			env.Modules[dep.Path] = dep.Version
+		}
+	}
+	env.DriverVersion = env.Modules[env.DriverModule]
+	return env
+}
+
+// pairs returns the environment as key/value pairs, in the style of the
+// configuration lines of the Go benchmark format.
+func (e Env) pairs() [][2]string {
+	return [][2]string{
+		{"driver", e.Driver},
+		{"go", e.GoVersion},
+		{"goos", e.GOOS},
+		{"goarch", e.GOARCH},
+		{"gomaxprocs", fmt.Sprint(e.GOMAXPROCS)},
+		{"cpu", e.CPU},
+		{"kernel", e.Kernel},
+		{"module", e.DriverModule + " " + e.DriverVersion},
+		{"sqlite", e.SqliteVersion},
+		{"sqlite-options", strings.Join(e.CompileOptions, " ")},
+	}
+}
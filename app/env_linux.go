@@ -0,0 +1,34 @@
+package app
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// readCPUModel returns the CPU model name from /proc/cpuinfo, or "" if it
+// cannot be read.
+func readCPUModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		name, value, ok := strings.Cut(sc.Text(), ":")
+		if ok && strings.TrimSpace(name) == "model name" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// readKernel returns the kernel release, or "" if it cannot be read.
+func readKernel() string {
+	data, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package app
+
+// readCPUModel is not supported on this platform.
+func readCPUModel() string {
+	return ""
+}
+
+// readKernel is not supported on this platform.
+func readKernel() string {
+	return ""
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"runtime"
+	"time"
+)
+
+// measurement holds the resources used by one benchmark phase.
+type measurement struct {
+	elapsed    time.Duration
+	allocBytes uint64        // bytes allocated on the heap
+	mallocs    uint64        // number of heap objects allocated
+	gcCycles   uint32        // number of completed GC cycles
+	gcPause    time.Duration // total GC stop-the-world pause time
+	self       rusage        // resource usage of this process
+	children   rusage        // resource usage of child processes, e.g. sqinn
+	io         ioCounters    // disk I/O of this process
+	haveIO     bool          // false if disk I/O could not be measured
+}
+
+// ioCounters holds the disk I/O counters of a process and its child
+// processes, as reported by /proc/<pid>/io on Linux.
+type ioCounters struct {
+	readBytes  int64 // bytes fetched from the storage layer
+	writeBytes int64 // bytes sent to the storage layer
+	syscr      int64 // read syscalls
+	syscw      int64 // write syscalls
+}
+
+// since returns the I/O counters since c0.
+func (c ioCounters) since(c0 ioCounters) ioCounters {
+	return ioCounters{
+		readBytes:  c.readBytes - c0.readBytes,
+		writeBytes: c.writeBytes - c0.writeBytes,
+		syscr:      c.syscr - c0.syscr,
+		syscw:      c.syscw - c0.syscw,
+	}
+}
+
+// records converts the I/O counters into records.
+func (c ioCounters) records(b benchmark, phase string, driver string, iteration int) []Record {
+	return []Record{
+		newRecord(b, phase, driver, float64(c.readBytes), "read-B", iteration),
+		newRecord(b, phase, driver, float64(c.writeBytes), "write-B", iteration),
+		newRecord(b, phase, driver, float64(c.syscr), "syscr", iteration),
+		newRecord(b, phase, driver, float64(c.syscw), "syscw", iteration),
+	}
+}
+
+// rusage holds the resource usage of a process, as reported by getrusage(2).
+// Terminated child processes are reported by getrusage(2). On Linux, child
+// processes that are still running are sampled from /proc/<pid>/stat and
+// /proc/<pid>/status, on other systems they are not accounted for.
+type rusage struct {
+	user   time.Duration // user CPU time
+	sys    time.Duration // system CPU time
+	nvcsw  int64         // voluntary context switches
+	nivcsw int64         // involuntary context switches
+	maxrss int64         // maximum resident set size in bytes
+}
+
+// since returns the resource usage since r0. Since maxrss is a high-water
+// mark, it is not subtracted.
+func (r rusage) since(r0 rusage) rusage {
+	return rusage{
+		user:   r.user - r0.user,
+		sys:    r.sys - r0.sys,
+		nvcsw:  r.nvcsw - r0.nvcsw,
+		nivcsw: r.nivcsw - r0.nivcsw,
+		maxrss: r.maxrss,
+	}
+}
+
+// plus returns the sum of two resource usages. Since maxrss is a
+// high-water mark, the larger one is used.
+func (r rusage) plus(o rusage) rusage {
+	return rusage{
+		user:   r.user + o.user,
+		sys:    r.sys + o.sys,
+		nvcsw:  r.nvcsw + o.nvcsw,
+		nivcsw: r.nivcsw + o.nivcsw,
+		maxrss: max(r.maxrss, o.maxrss),
+	}
+}
+
+// records converts the resource usage into records, with units prefixed
+// by prefix.
+func (r rusage) records(b benchmark, phase string, driver string, prefix string, iteration int) []Record {
+	return []Record{
+		newRecord(b, phase, driver, float64(r.user.Nanoseconds()), prefix+"user-ns", iteration),
+		newRecord(b, phase, driver, float64(r.sys.Nanoseconds()), prefix+"sys-ns", iteration),
+		newRecord(b, phase, driver, float64(r.nvcsw), prefix+"nvcsw", iteration),
+		newRecord(b, phase, driver, float64(r.nivcsw), prefix+"nivcsw", iteration),
+		newRecord(b, phase, driver, float64(r.maxrss), prefix+"maxrss-B", iteration),
+	}
+}
+
+// meter measures a benchmark phase.
+type meter struct {
+	t0       time.Time
+	mem      runtime.MemStats
+	self     rusage
+	children rusage
+	io       ioCounters
+	haveIO   bool
+}
+
+// startMeter starts measuring a benchmark phase.
+func startMeter() *meter {
+	m := &meter{}
+	runtime.ReadMemStats(&m.mem)
+	m.self, m.children = readRusage()
+	m.io, m.haveIO = readIO()
+	m.t0 = time.Now()
+	return m
+}
+
+// stop stops measuring and returns the measurement since startMeter.
+func (m *meter) stop() measurement {
+	elapsed := time.Since(m.t0)
+	self, children := readRusage()
+	io, haveIO := readIO()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return measurement{
+		elapsed:    elapsed,
+		allocBytes: mem.TotalAlloc - m.mem.TotalAlloc,
+		mallocs:    mem.Mallocs - m.mem.Mallocs,
+		gcCycles:   mem.NumGC - m.mem.NumGC,
+		gcPause:    time.Duration(mem.PauseTotalNs - m.mem.PauseTotalNs),
+		self:       self.since(m.self),
+		children:   children.since(m.children),
+		io:         io.since(m.io),
+		haveIO:     m.haveIO && haveIO,
+	}
+}
+
+// records converts a measurement of a phase that processed nrows rows into
+// one Record per metric.
+func (m measurement) records(b benchmark, phase string, driver string, nrows int, iteration int) []Record {
+	records := []Record{
+		newRecord(b, phase, driver, float64(m.elapsed.Nanoseconds()), "ns", iteration),
+		newRecord(b, phase, driver, perRow(m.elapsed, nrows), "ns/row", iteration),
+		newRecord(b, phase, driver, float64(m.allocBytes), "B", iteration),
+		newRecord(b, phase, driver, float64(m.mallocs), "allocs", iteration),
+		newRecord(b, phase, driver, float64(m.gcCycles), "gc-cycles", iteration),
+		newRecord(b, phase, driver, float64(m.gcPause.Nanoseconds()), "gc-pause-ns", iteration),
+	}
+	if haveRusage {
+		records = append(records, m.self.records(b, phase, driver, "", iteration)...)
+		records = append(records, m.children.records(b, phase, driver, "child-", iteration)...)
+	}
+	if m.haveIO {
+		records = append(records, m.io.records(b, phase, driver, iteration)...)
+	}
+	return records
+}
+
+// perRow returns the nanoseconds per row, or 0 if there were no rows.
+func perRow(d time.Duration, nrows int) float64 {
+	if nrows == 0 {
+		return 0
+	}
+	return float64(d.Nanoseconds()) / float64(nrows)
+}
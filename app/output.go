@@ -0,0 +1,282 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// reporter writes benchmark records in a specific output format.
+type reporter interface {
+	// header writes the environment of the run, before any records.
+	header(env Env)
+	// report writes the records of all iterations of a benchmark.
+	report(b benchmark, records []Record)
+	// close flushes pending output.
+	close()
+}
+
+func newReporter(format string, unit string, w io.Writer) reporter {
+	switch format {
+	case "text":
+		scale, ok := timeUnits[unit]
+		if !ok {
+			log.Fatalf("unknown time unit %q", unit)
+		}
+		return &textReporter{scale}
+	case "json":
+		return &jsonReporter{json.NewEncoder(w)}
+	case "csv":
+		return &csvReporter{w: csv.NewWriter(w)}
+	case "benchstat":
+		return &benchstatReporter{w}
+	}
+	log.Fatalf("unknown output format %q", format)
+	return nil
+}
+
+// timeUnits maps time unit names to their length in nanoseconds.
+var timeUnits = map[string]float64{
+	"ns": 1,
+	"us": 1e3,
+	"ms": 1e6,
+	"s":  1e9,
+}
+
+// textReporter prints human-readable lines for each benchmark phase.
+// Durations are printed in the configured time unit, followed by a line for
+// the time per row and a line with all other metrics of the phase.
+// If there was more than one iteration, the median is printed, followed
+// by min, max, mean, p95 and stddev. The metrics line shows medians only.
+// Failed iterations are printed with their error and left out of the
+// statistics.
+type textReporter struct {
+	scale float64 // nanoseconds per time unit
+}
+
+func (t *textReporter) header(env Env) {
+	for _, p := range env.pairs() {
+		log.Printf("# %-14s %s", p[0], p[1])
+	}
+	log.Print("")
+}
+
+func (t *textReporter) report(b benchmark, records []Record) {
+	type key struct{ phase, unit string }
+	var phases []string
+	units := make(map[string][]string)
+	values := make(map[key][]float64)
+	last := make(map[key]Record)
+	for _, r := range records {
+		if r.Error != "" {
+			log.Printf("%s - %-6s - %-10s - FAILED in iteration %d: %s", b, r.Phase, r.Driver, r.Iteration, r.Error)
+			continue
+		}
+		k := key{r.Phase, r.Unit}
+		if _, ok := units[r.Phase]; !ok {
+			phases = append(phases, r.Phase)
+		}
+		if _, ok := last[k]; !ok {
+			units[r.Phase] = append(units[r.Phase], r.Unit)
+		}
+		value := r.Value
+		if r.Unit == "ns" {
+			value /= t.scale
+		}
+		values[k] = append(values[k], value)
+		last[k] = r
+	}
+	for _, phase := range phases {
+		var metrics []string
+		for _, unit := range units[phase] {
+			k := key{phase, unit}
+			r := last[k]
+			// durations and dbsize are printed without unit, like always
+			prec := 0
+			suffix := " " + unit
+			switch unit {
+			case "ns":
+				prec = 3
+				suffix = ""
+			case "bytes":
+				suffix = ""
+			case "ns/row":
+			default:
+				metrics = append(metrics, fmt.Sprintf("%.0f %s", newStats(values[k]).median, unit))
+				continue
+			}
+			if len(values[k]) == 1 || unit == "bytes" {
+				v := values[k][len(values[k])-1]
+				log.Printf("%s - %-6s - %-10s - %10.*f%s", b, phase, r.Driver, prec, v, suffix)
+				continue
+			}
+			st := newStats(values[k])
+			log.Printf("%s - %-6s - %-10s - %10.*f%s - min %.*f - max %.*f - mean %.*f - p95 %.*f - stddev %.*f",
+				b, phase, r.Driver, prec, st.median, suffix,
+				prec, st.min, prec, st.max, prec, st.mean, prec, st.p95, prec, st.stddev)
+		}
+		if len(metrics) > 0 {
+			log.Printf("%s - %-6s - %-10s - %s", b, phase, last[key{phase, units[phase][0]}].Driver, strings.Join(metrics, ", "))
+		}
+	}
+}
+
+func (t *textReporter) close() {}
+
+// jsonReporter writes one JSON object per record and line, preceded by
+// a line with the environment, see ReadOutput.
+type jsonReporter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonReporter) header(env Env) {
+	err := j.enc.Encode(envLine{&env})
+	MustBeNil(err)
+}
+
+func (j *jsonReporter) report(b benchmark, records []Record) {
+	for _, r := range records {
+		err := j.enc.Encode(r)
+		MustBeNil(err)
+	}
+}
+
+func (j *jsonReporter) close() {}
+
+// csvReporter writes one CSV row per record, preceded by a header row.
+// The output is plain CSV: the environment is repeated in the last columns
+// of each row, so that standard CSV readers can ingest it.
+type csvReporter struct {
+	w   *csv.Writer
+	env Env
+}
+
+func (c *csvReporter) header(env Env) {
+	c.env = env
+	err := c.w.Write([]string{"benchmark", "parameter", "phase", "driver", "value", "unit", "iteration", "error", "journalMode", "synchronous",
+		"goVersion", "goos", "goarch", "gomaxprocs", "cpu", "kernel", "driverModule", "driverVersion", "sqliteVersion", "compileOptions"})
+	MustBeNil(err)
+}
+
+func (c *csvReporter) report(b benchmark, records []Record) {
+	for _, r := range records {
+		err := c.w.Write([]string{
+			r.Benchmark,
+			strconv.Itoa(r.Parameter),
+			r.Phase,
+			r.Driver,
+			strconv.FormatFloat(r.Value, 'f', -1, 64),
+			r.Unit,
+			strconv.Itoa(r.Iteration),
+			r.Error,
+			r.JournalMode,
+			r.Synchronous,
+			c.env.GoVersion,
+			c.env.GOOS,
+			c.env.GOARCH,
+			strconv.Itoa(c.env.GOMAXPROCS),
+			c.env.CPU,
+			c.env.Kernel,
+			c.env.DriverModule,
+			c.env.DriverVersion,
+			c.env.SqliteVersion,
+			strings.Join(c.env.CompileOptions, " "),
+		})
+		MustBeNil(err)
+	}
+	c.w.Flush()
+	MustBeNil(c.w.Error())
+}
+
+func (c *csvReporter) close() {
+	c.w.Flush()
+	MustBeNil(c.w.Error())
+}
+
+// benchstatReporter writes lines in the Go benchmark format, so that the
+// output can be fed into golang.org/x/perf/cmd/benchstat, for example:
+//
+//	BenchmarkMany/N=10/query/journal=DELETE/sync=FULL/driver=mattn 1 32000000 ns/op 3200 ns/row
+//
+// Failed iterations are written like failed Go benchmarks, which
+// benchstat ignores:
+//
+//	--- FAIL: BenchmarkMany/N=10/query/journal=DELETE/sync=FULL/driver=mattn
+//	    database is locked
+type benchstatReporter struct {
+	w io.Writer
+}
+
+// header writes the environment as configuration lines, which benchstat
+// attaches to all following results, and marks the units where higher
+// values are better, so that benchstat compares them the right way round.
+func (s *benchstatReporter) header(env Env) {
+	for _, p := range env.pairs() {
+		_, err := fmt.Fprintf(s.w, "%s: %s\n", p[0], p[1])
+		MustBeNil(err)
+	}
+	for _, unit := range higherIsBetterUnits {
+		_, unit = benchstatUnit(Record{Unit: unit})
+		_, err := fmt.Fprintf(s.w, "Unit %s better=higher\n", unit)
+		MustBeNil(err)
+	}
+}
+
+func (s *benchstatReporter) report(b benchmark, records []Record) {
+	// records of the same phase and iteration share one line
+	var line strings.Builder
+	var prev Record
+	flush := func() {
+		if line.Len() > 0 {
+			_, err := fmt.Fprintln(s.w, line.String())
+			MustBeNil(err)
+			line.Reset()
+		}
+	}
+	for _, r := range records {
+		name := "Benchmark" + strings.ToUpper(r.Benchmark[:1]) + r.Benchmark[1:]
+		if r.Parameter != 0 {
+			name += fmt.Sprintf("/N=%d", r.Parameter)
+		}
+		name += fmt.Sprintf("/%s/journal=%s/sync=%s/driver=%s", r.Phase, r.JournalMode, r.Synchronous, r.Driver)
+		if r.Error != "" {
+			flush()
+			_, err := fmt.Fprintf(s.w, "--- FAIL: %s\n    %s\n", name, strings.ReplaceAll(r.Error, "\n", "\n    "))
+			MustBeNil(err)
+			prev = Record{}
+			continue
+		}
+		if r.Phase != prev.Phase || r.Iteration != prev.Iteration {
+			flush()
+			fmt.Fprintf(&line, "%s 1", name)
+		}
+		value, unit := benchstatUnit(r)
+		fmt.Fprintf(&line, " %s %s", strconv.FormatFloat(value, 'f', -1, 64), unit)
+		prev = r
+	}
+	flush()
+}
+
+func (s *benchstatReporter) close() {}
+
+// benchstatUnit converts a record value to a benchstat unit. Totals of a
+// phase get an "/op" suffix, rates, per-row values and latency percentiles
+// keep their unit.
+func benchstatUnit(r Record) (float64, string) {
+	switch r.Unit {
+	case "ns":
+		return r.Value, "ns/op"
+	case "ns/row", "ns/tx", "lookups/s":
+		return r.Value, r.Unit
+	case "bytes":
+		return r.Value, "bytes/db"
+	}
+	if strings.HasPrefix(r.Unit, "latency-") {
+		return r.Value, r.Unit
+	}
+	return r.Value, r.Unit + "/op"
+}
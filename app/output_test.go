@@ -0,0 +1,239 @@
+package app
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var testEnv = Env{
+	Driver:         "mattn",
+	GoVersion:      "go1.22.0",
+	GOOS:           "linux",
+	GOARCH:         "amd64",
+	GOMAXPROCS:     4,
+	CPU:            "Test CPU",
+	Kernel:         "6.1.0",
+	DriverModule:   "github.com/mattn/go-sqlite3",
+	DriverVersion:  "v1.14.22",
+	SqliteVersion:  "3.45.1",
+	CompileOptions: []string{"ENABLE_FTS5", "THREADSAFE=1"},
+}
+
+func testBenchmark() benchmark {
+	return benchmark{name: "many", param: 10, label: "3_many/0010", pragmas: pragmas{"WAL", "NORMAL"}}
+}
+
+func testRecords() []Record {
+	b := testBenchmark()
+	return []Record{
+		newRecord(b, "insert", "mattn", 2_000_000, "ns", 1),
+		newRecord(b, "insert", "mattn", 200_000, "ns/row", 1),
+		newRecord(b, "query", "mattn", 1_000_000, "ns", 1),
+		newRecord(b, "query", "mattn", 12_345.5, "lookups/s", 1),
+		newErrorRecord(b, "insert", "mattn", errTest("database is locked"), 2),
+	}
+}
+
+type errTest string
+
+func (e errTest) Error() string { return string(e) }
+
+func TestBenchstatUnit(t *testing.T) {
+	tests := []struct {
+		unit     string
+		wantUnit string
+	}{
+		{"ns", "ns/op"},
+		{"ns/row", "ns/row"},
+		{"ns/tx", "ns/tx"},
+		{"lookups/s", "lookups/s"},
+		{"bytes", "bytes/db"},
+		{"latency-p99-ns", "latency-p99-ns"},
+		{"allocs", "allocs/op"},
+		{"cancelled", "cancelled/op"},
+		{"overlap", "overlap/op"},
+	}
+	for _, tt := range tests {
+		value, unit := benchstatUnit(Record{Value: 1.5, Unit: tt.unit})
+		if value != 1.5 || unit != tt.wantUnit {
+			t.Errorf("benchstatUnit(%q) = %g %q, want 1.5 %q", tt.unit, value, unit, tt.wantUnit)
+		}
+	}
+}
+
+func TestBenchstatReporter(t *testing.T) {
+	var buf bytes.Buffer
+	rep := newReporter("benchstat", "ms", &buf)
+	rep.header(testEnv)
+	rep.report(testBenchmark(), testRecords())
+	rep.close()
+	want := []string{
+		"driver: mattn",
+		"go: go1.22.0",
+		"goos: linux",
+		"goarch: amd64",
+		"gomaxprocs: 4",
+		"cpu: Test CPU",
+		"kernel: 6.1.0",
+		"module: github.com/mattn/go-sqlite3 v1.14.22",
+		"sqlite: 3.45.1",
+		"sqlite-options: ENABLE_FTS5 THREADSAFE=1",
+		"Unit lookups/s better=higher",
+		"Unit cancelled/op better=higher",
+		"Unit overlap/op better=higher",
+		"BenchmarkMany/N=10/insert/journal=WAL/sync=NORMAL/driver=mattn 1 2000000 ns/op 200000 ns/row",
+		"BenchmarkMany/N=10/query/journal=WAL/sync=NORMAL/driver=mattn 1 1000000 ns/op 12345.5 lookups/s",
+		"--- FAIL: BenchmarkMany/N=10/insert/journal=WAL/sync=NORMAL/driver=mattn",
+		"    database is locked",
+	}
+	got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("benchstat output:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestJsonRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	rep := newReporter("json", "ms", &buf)
+	rep.header(testEnv)
+	rep.report(testBenchmark(), testRecords())
+	rep.close()
+	envs, records, err := ReadOutput(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(envs) != 1 || !reflect.DeepEqual(envs[0], testEnv) {
+		t.Fatalf("envs = %+v, want [%+v]", envs, testEnv)
+	}
+	if !reflect.DeepEqual(records, testRecords()) {
+		t.Fatalf("records = %+v, want %+v", records, testRecords())
+	}
+}
+
+func TestReadRecordsDefaults(t *testing.T) {
+	tests := []struct {
+		line string
+		want Record
+	}{
+		// written before the pragmas were configurable
+		{
+			`{"benchmark":"simple","parameter":0,"phase":"insert","driver":"mattn","value":42,"unit":"ns","iteration":1}`,
+			Record{Benchmark: "simple", Phase: "insert", Driver: "mattn", JournalMode: "DELETE", Synchronous: "FULL", Value: 42, Unit: "ns", Iteration: 1},
+		},
+		{
+			`{"benchmark":"simple","parameter":0,"phase":"insert","driver":"mattn","journalMode":"WAL","synchronous":"OFF","value":42,"unit":"ns","iteration":1,"round":2}`,
+			Record{Benchmark: "simple", Phase: "insert", Driver: "mattn", JournalMode: "WAL", Synchronous: "OFF", Value: 42, Unit: "ns", Iteration: 1, Round: 2},
+		},
+	}
+	for _, tt := range tests {
+		records, err := ReadRecords(strings.NewReader(tt.line + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 || records[0] != tt.want {
+			t.Errorf("ReadRecords(%s) = %+v, want [%+v]", tt.line, records, tt.want)
+		}
+	}
+}
+
+func TestCsvRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	rep := newReporter("csv", "ms", &buf)
+	rep.header(testEnv)
+	rep.report(testBenchmark(), testRecords())
+	rep.close()
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(testRecords())+1 {
+		t.Fatalf("want header and %d rows, got %d rows", len(testRecords()), len(rows))
+	}
+	col := make(map[string]int)
+	for i, name := range rows[0] {
+		col[name] = i
+	}
+	atoi := func(s string) int {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	var records []Record
+	for _, row := range rows[1:] {
+		if len(row) != len(rows[0]) {
+			t.Fatalf("row %v has %d fields, want %d", row, len(row), len(rows[0]))
+		}
+		value, err := strconv.ParseFloat(row[col["value"]], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, Record{
+			Benchmark:   row[col["benchmark"]],
+			Parameter:   atoi(row[col["parameter"]]),
+			Phase:       row[col["phase"]],
+			Driver:      row[col["driver"]],
+			JournalMode: row[col["journalMode"]],
+			Synchronous: row[col["synchronous"]],
+			Value:       value,
+			Unit:        row[col["unit"]],
+			Iteration:   atoi(row[col["iteration"]]),
+			Error:       row[col["error"]],
+		})
+		env := Env{
+			Driver:         row[col["driver"]],
+			GoVersion:      row[col["goVersion"]],
+			GOOS:           row[col["goos"]],
+			GOARCH:         row[col["goarch"]],
+			GOMAXPROCS:     atoi(row[col["gomaxprocs"]]),
+			CPU:            row[col["cpu"]],
+			Kernel:         row[col["kernel"]],
+			DriverModule:   row[col["driverModule"]],
+			DriverVersion:  row[col["driverVersion"]],
+			SqliteVersion:  row[col["sqliteVersion"]],
+			CompileOptions: strings.Fields(row[col["compileOptions"]]),
+		}
+		if !reflect.DeepEqual(env, testEnv) {
+			t.Fatalf("env of row %v = %+v, want %+v", row, env, testEnv)
+		}
+	}
+	if !reflect.DeepEqual(records, testRecords()) {
+		t.Fatalf("records = %+v, want %+v", records, testRecords())
+	}
+}
+
+func TestTextReporter(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(w io.Writer, flags int) {
+		log.SetOutput(w)
+		log.SetFlags(flags)
+	}(log.Writer(), log.Flags())
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	b := testBenchmark()
+	records := append(testRecords(),
+		newRecord(b, "insert", "mattn", 4_000_000, "ns", 3),
+		newRecord(b, "insert", "mattn", 400_000, "ns/row", 3),
+	)
+	rep := newReporter("text", "ms", &buf)
+	rep.report(b, records)
+	rep.close()
+	want := []string{
+		"3_many/0010 WAL/NORMAL - insert - mattn      - FAILED in iteration 2: database is locked",
+		"3_many/0010 WAL/NORMAL - insert - mattn      -      3.000 - min 2.000 - max 4.000 - mean 3.000 - p95 3.900 - stddev 1.414",
+		"3_many/0010 WAL/NORMAL - insert - mattn      -     300000 ns/row - min 200000 - max 400000 - mean 300000 - p95 390000 - stddev 141421",
+		"3_many/0010 WAL/NORMAL - query  - mattn      -      1.000",
+		"3_many/0010 WAL/NORMAL - query  - mattn      - 12346 lookups/s",
+	}
+	got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("text output:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readIO returns the I/O counters of the current process and its running
+// child processes, e.g. sqinn, from /proc/<pid>/io. Terminated children
+// are included in /proc/self/io once they have been waited for. It returns
+// false if /proc/self/io cannot be read, e.g. because the kernel was built
+// without task I/O accounting.
+func readIO() (ioCounters, bool) {
+	c, ok := readProcIO("/proc/self/io")
+	if !ok {
+		return ioCounters{}, false
+	}
+	for _, pid := range liveChildren() {
+		// children that terminate while they are read are skipped
+		cc, ok := readProcIO("/proc/" + strconv.Itoa(pid) + "/io")
+		if ok {
+			c.readBytes += cc.readBytes
+			c.writeBytes += cc.writeBytes
+			c.syscr += cc.syscr
+			c.syscw += cc.syscw
+		}
+	}
+	return c, true
+}
+
+func readProcIO(filename string) (ioCounters, bool) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return ioCounters{}, false
+	}
+	defer f.Close()
+	var c ioCounters
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		name, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "read_bytes":
+			c.readBytes = n
+		case "write_bytes":
+			c.writeBytes = n
+		case "syscr":
+			c.syscr = n
+		case "syscw":
+			c.syscw = n
+		}
+	}
+	return c, sc.Err() == nil
+}
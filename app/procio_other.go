@@ -0,0 +1,8 @@
+//go:build !linux
+
+package app
+
+// readIO is not supported on this platform.
+func readIO() (ioCounters, bool) {
+	return ioCounters{}, false
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+)
+
+// Record is a single measurement of a benchmark run.
+type Record struct {
+	Benchmark   string  `json:"benchmark"`             // e.g. "many"
+	Parameter   int     `json:"parameter"`             // e.g. number of users, 0 if not applicable
+	Phase       string  `json:"phase"`                 // "insert", "query" or "dbsize"
+	Driver      string  `json:"driver"`                // e.g. "mattn"
+	JournalMode string  `json:"journalMode,omitempty"` // e.g. "WAL"
+	Synchronous string  `json:"synchronous,omitempty"` // e.g. "NORMAL"
+	Value       float64 `json:"value"`
+	Unit        string  `json:"unit"`            // e.g. "ns"
+	Iteration   int     `json:"iteration"`       // 1-based
+	Round       int     `json:"round,omitempty"` // 1-based, set by bench-runner
+	Error       string  `json:"error,omitempty"` // error message if the phase failed, unit is "error"
+}
+
+// envLine is the json output line that holds the environment of a run.
+type envLine struct {
+	Env *Env `json:"env"`
+}
+
+// ReadRecords reads records in json output format, one per line.
+// Environment lines are skipped.
+func ReadRecords(r io.Reader) ([]Record, error) {
+	_, records, err := ReadOutput(r)
+	return records, err
+}
+
+// ReadOutput reads environments and records in json output format, one
+// per line. There is one environment for each benchmark binary run.
+func ReadOutput(r io.Reader) ([]Env, []Record, error) {
+	var envs []Env
+	var records []Record
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return envs, records, nil
+		}
+		if err != nil {
+			return envs, records, err
+		}
+		var line envLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			return envs, records, err
+		}
+		if line.Env != nil {
+			envs = append(envs, *line.Env)
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return envs, records, err
+		}
+		// records written before the pragmas were configurable
+		if rec.JournalMode == "" {
+			rec.JournalMode = DefaultJournalMode
+		}
+		if rec.Synchronous == "" {
+			rec.Synchronous = DefaultSynchronous
+		}
+		records = append(records, rec)
+	}
+}
+
+// WriteEnv writes an environment line in json output format.
+func WriteEnv(w io.Writer, env Env) error {
+	return json.NewEncoder(w).Encode(envLine{&env})
+}
+
+// newErrorRecord returns a record for a benchmark phase that failed.
+func newErrorRecord(b benchmark, phase string, driver string, err error, iteration int) Record {
+	r := newRecord(b, phase, driver, 0, "error", iteration)
+	r.Error = err.Error()
+	return r
+}
+
+func newRecord(b benchmark, phase string, driver string, value float64, unit string, iteration int) Record {
+	return Record{
+		Benchmark:   b.name,
+		Parameter:   b.param,
+		Phase:       phase,
+		Driver:      driver,
+		JournalMode: b.pragmas.journalMode,
+		Synchronous: b.pragmas.synchronous,
+		Value:       value,
+		Unit:        unit,
+		Iteration:   iteration,
+	}
+}
+
+// higherIsBetterUnits are the units of rates and counts of successes.
+var higherIsBetterUnits = []string{"lookups/s", "cancelled", "overlap"}
+
+// HigherIsBetter tells whether a larger value of unit is an improvement.
+// For all other units, such as durations, sizes and counts of allocations
+// or system calls, smaller is better.
+func HigherIsBetter(unit string) bool {
+	return slices.Contains(higherIsBetterUnits, unit)
+}
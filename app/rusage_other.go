@@ -0,0 +1,10 @@
+//go:build !unix
+
+package app
+
+const haveRusage = false
+
+// readRusage is not supported on this platform and returns zero usage.
+func readRusage() (self, children rusage) {
+	return rusage{}, rusage{}
+}
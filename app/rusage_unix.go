@@ -0,0 +1,38 @@
+//go:build unix
+
+package app
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+const haveRusage = true
+
+// readRusage returns the resource usage of the current process and of its
+// child processes: the terminated and waited-for ones, and on Linux the
+// running ones. A child that terminates between two readings moves from
+// the running to the terminated ones, so the difference of two readings
+// is the usage of the children in between.
+func readRusage() (self, children rusage) {
+	return getrusage(syscall.RUSAGE_SELF), getrusage(syscall.RUSAGE_CHILDREN).plus(readLiveRusage())
+}
+
+func getrusage(who int) rusage {
+	var ru syscall.Rusage
+	err := syscall.Getrusage(who, &ru)
+	MustBeNil(err)
+	// maxrss is reported in bytes on darwin, in kilobytes elsewhere
+	maxrss := int64(ru.Maxrss)
+	if runtime.GOOS != "darwin" && runtime.GOOS != "ios" {
+		maxrss *= 1024
+	}
+	return rusage{
+		user:   time.Duration(ru.Utime.Nano()),
+		sys:    time.Duration(ru.Stime.Nano()),
+		nvcsw:  int64(ru.Nvcsw),
+		nivcsw: int64(ru.Nivcsw),
+		maxrss: maxrss,
+	}
+}
@@ -1,80 +1,185 @@
 package app
 
 import (
+	"context"
 	"database/sql"
 )
 
 // SqlDb is a Db implementation that uses database/sql package.
 type SqlDb struct {
-	driverName string
-	db         *sql.DB
+	driverName  string
+	db          *sql.DB
+	isInterrupt func(err error) bool
 }
 
 var _ Db = (*SqlDb)(nil)
 
-func NewSqlDb(driverName string, db *sql.DB) *SqlDb {
-	return &SqlDb{driverName, db}
+// NewSqlDb returns a Db for a database/sql database. Since the error types
+// differ between drivers, isInterrupt tells whether an error of the driver
+// has the SQLITE_INTERRUPT result code.
+func NewSqlDb(driverName string, db *sql.DB, isInterrupt func(err error) bool) *SqlDb {
+	return &SqlDb{driverName, db, isInterrupt}
 }
 
 func (d *SqlDb) DriverName() string {
 	return d.driverName
 }
 
-func (d *SqlDb) Exec(sqls ...string) {
+func (d *SqlDb) SqliteVersion(ctx context.Context) (string, error) {
+	var version string
+	err := d.db.QueryRowContext(ctx, "SELECT sqlite_version()").Scan(&version)
+	return version, err
+}
+
+func (d *SqlDb) CompileOptions(ctx context.Context) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, "PRAGMA compile_options")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var options []string
+	for rows.Next() {
+		var option string
+		err = rows.Scan(&option)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, option)
+	}
+	return options, rows.Err()
+}
+
+func (d *SqlDb) Exec(ctx context.Context, sqls ...string) error {
 	for _, s := range sqls {
-		_, err := d.db.Exec(s)
-		MustBeNil(err)
+		_, err := d.db.ExecContext(ctx, s)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (d *SqlDb) InsertUsers(insertSql string, users []User) {
-	tx, err := d.db.Begin()
-	MustBeNil(err)
-	stmt, err := tx.Prepare(insertSql)
-	MustBeNil(err)
+func (d *SqlDb) InsertUsers(ctx context.Context, insertSql string, users []User) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, insertSql)
+	if err != nil {
+		return err
+	}
 	for _, u := range users {
-		_, err = stmt.Exec(u.Id, BindTime(u.Created), u.Email, u.Active)
-		MustBeNil(err)
+		_, err = stmt.ExecContext(ctx, u.Id, BindTime(u.Created), u.Email, u.Active)
+		if err != nil {
+			return err
+		}
 	}
 	err = stmt.Close()
-	MustBeNil(err)
-	err = tx.Commit()
-	MustBeNil(err)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (d *SqlDb) InsertArticles(insertSql string, articles []Article) {
-	tx, err := d.db.Begin()
-	MustBeNil(err)
-	stmt, err := tx.Prepare(insertSql)
-	MustBeNil(err)
+func (d *SqlDb) InsertArticles(ctx context.Context, insertSql string, articles []Article) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, insertSql)
+	if err != nil {
+		return err
+	}
 	for _, u := range articles {
-		_, err = stmt.Exec(u.Id, BindTime(u.Created), u.UserId, u.Text)
-		MustBeNil(err)
+		_, err = stmt.ExecContext(ctx, u.Id, BindTime(u.Created), u.UserId, u.Text)
+		if err != nil {
+			return err
+		}
 	}
 	err = stmt.Close()
-	MustBeNil(err)
-	err = tx.Commit()
-	MustBeNil(err)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (d *SqlDb) InsertComments(insertSql string, comments []Comment) {
-	tx, err := d.db.Begin()
-	MustBeNil(err)
-	stmt, err := tx.Prepare(insertSql)
-	MustBeNil(err)
+func (d *SqlDb) InsertComments(ctx context.Context, insertSql string, comments []Comment) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, insertSql)
+	if err != nil {
+		return err
+	}
 	for _, u := range comments {
-		_, err = stmt.Exec(u.Id, BindTime(u.Created), u.ArticleId, u.Text)
-		MustBeNil(err)
+		_, err = stmt.ExecContext(ctx, u.Id, BindTime(u.Created), u.ArticleId, u.Text)
+		if err != nil {
+			return err
+		}
+	}
+	err = stmt.Close()
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *SqlDb) UpdateUsers(ctx context.Context, updateSql string, users []User) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, updateSql)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		_, err = stmt.ExecContext(ctx, BindTime(u.Created), u.Email, u.Active, u.Id)
+		if err != nil {
+			return err
+		}
 	}
 	err = stmt.Close()
-	MustBeNil(err)
-	err = tx.Commit()
-	MustBeNil(err)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (d *SqlDb) FindUsers(querySql string) []User {
-	rows, err := d.db.Query(querySql)
-	MustBeNil(err)
+func (d *SqlDb) DeleteByIds(ctx context.Context, deleteSql string, ids []int) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, deleteSql)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		_, err = stmt.ExecContext(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+	err = stmt.Close()
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *SqlDb) FindUsers(ctx context.Context, querySql string) ([]User, error) {
+	rows, err := d.db.QueryContext(ctx, querySql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 	var id sql.NullInt32
 	var created sql.NullInt64
 	var email sql.NullString
@@ -82,15 +187,20 @@ func (d *SqlDb) FindUsers(querySql string) []User {
 	var users []User
 	for rows.Next() {
 		err = rows.Scan(&id, &created, &email, &active)
-		MustBeNil(err)
+		if err != nil {
+			return nil, err
+		}
 		users = append(users, NewUser(int(id.Int32), UnbindTime(created.Int64), email.String, active.Bool))
 	}
-	return users
+	return users, rows.Err()
 }
 
-func (d *SqlDb) FindArticles(querySql string) []Article {
-	rows, err := d.db.Query(querySql)
-	MustBeNil(err)
+func (d *SqlDb) FindArticles(ctx context.Context, querySql string) ([]Article, error) {
+	rows, err := d.db.QueryContext(ctx, querySql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 	var id sql.NullInt32
 	var created sql.NullInt64
 	var userId sql.NullInt32
@@ -98,15 +208,20 @@ func (d *SqlDb) FindArticles(querySql string) []Article {
 	var articles []Article
 	for rows.Next() {
 		err = rows.Scan(&id, &created, &userId, &text)
-		MustBeNil(err)
+		if err != nil {
+			return nil, err
+		}
 		articles = append(articles, NewArticle(int(id.Int32), UnbindTime(created.Int64), int(userId.Int32), text.String))
 	}
-	return articles
+	return articles, rows.Err()
 }
 
-func (d *SqlDb) FindUsersArticlesComments(querySql string) ([]User, []Article, []Comment) {
-	rows, err := d.db.Query(querySql)
-	MustBeNil(err)
+func (d *SqlDb) FindUsersArticlesComments(ctx context.Context, querySql string) ([]User, []Article, []Comment, error) {
+	rows, err := d.db.QueryContext(ctx, querySql)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
 	var userId sql.NullInt32
 	var userCreated sql.NullInt64
 	var userEmail sql.NullString
@@ -130,7 +245,9 @@ func (d *SqlDb) FindUsersArticlesComments(querySql string) ([]User, []Article, [
 		err = rows.Scan(&userId, &userCreated, &userEmail, &userActive,
 			&articleId, &articleCreated, &articleUserId, &articleText,
 			&commentId, &commentCreated, &commentArticleId, &commentText)
-		MustBeNil(err)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 		user := NewUser(int(userId.Int32), UnbindTime(userCreated.Int64), userEmail.String, userActive.Bool)
 		article := NewArticle(int(articleId.Int32), UnbindTime(articleCreated.Int64), int(articleUserId.Int32), articleText.String)
 		comment := NewComment(int(commentId.Int32), UnbindTime(commentCreated.Int64), int(commentArticleId.Int32), commentText.String)
@@ -150,10 +267,99 @@ func (d *SqlDb) FindUsersArticlesComments(querySql string) ([]User, []Article, [
 			comments = append(comments, comment)
 		}
 	}
-	return users, articles, comments
+	return users, articles, comments, rows.Err()
+}
+
+func (d *SqlDb) ScanUsers(ctx context.Context, querySql string, fn func(User) error) error {
+	rows, err := d.db.QueryContext(ctx, querySql)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var id sql.NullInt32
+	var created sql.NullInt64
+	var email sql.NullString
+	var active sql.NullBool
+	for rows.Next() {
+		err = rows.Scan(&id, &created, &email, &active)
+		if err != nil {
+			return err
+		}
+		err = fn(NewUser(int(id.Int32), UnbindTime(created.Int64), email.String, active.Bool))
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (d *SqlDb) ScanUsersArticlesComments(ctx context.Context, querySql string, fn func(User, Article, Comment) error) error {
+	rows, err := d.db.QueryContext(ctx, querySql)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var userId sql.NullInt32
+	var userCreated sql.NullInt64
+	var userEmail sql.NullString
+	var userActive sql.NullBool
+	var articleId sql.NullInt32
+	var articleCreated sql.NullInt64
+	var articleUserId sql.NullInt32
+	var articleText sql.NullString
+	var commentId sql.NullInt32
+	var commentCreated sql.NullInt64
+	var commentArticleId sql.NullInt32
+	var commentText sql.NullString
+	for rows.Next() {
+		err = rows.Scan(&userId, &userCreated, &userEmail, &userActive,
+			&articleId, &articleCreated, &articleUserId, &articleText,
+			&commentId, &commentCreated, &commentArticleId, &commentText)
+		if err != nil {
+			return err
+		}
+		err = fn(
+			NewUser(int(userId.Int32), UnbindTime(userCreated.Int64), userEmail.String, userActive.Bool),
+			NewArticle(int(articleId.Int32), UnbindTime(articleCreated.Int64), int(articleUserId.Int32), articleText.String),
+			NewComment(int(commentId.Int32), UnbindTime(commentCreated.Int64), int(commentArticleId.Int32), commentText.String),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (d *SqlDb) FindUsersById(ctx context.Context, querySql string, ids []int, fn func(User) error) error {
+	stmt, err := d.db.PrepareContext(ctx, querySql)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	var id sql.NullInt32
+	var created sql.NullInt64
+	var email sql.NullString
+	var active sql.NullBool
+	for _, userId := range ids {
+		err = stmt.QueryRowContext(ctx, userId).Scan(&id, &created, &email, &active)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = fn(NewUser(int(id.Int32), UnbindTime(created.Int64), email.String, active.Bool))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *SqlDb) IsInterrupt(err error) bool {
+	return d.isInterrupt(err)
 }
 
-func (d *SqlDb) Close() {
-	err := d.db.Close()
-	MustBeNil(err)
+func (d *SqlDb) Close() error {
+	return d.db.Close()
 }
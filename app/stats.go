@@ -0,0 +1,66 @@
+package app
+
+import (
+	"math"
+	"sort"
+)
+
+// stats summarizes a series of measurements.
+type stats struct {
+	min    float64
+	max    float64
+	median float64
+	mean   float64
+	p95    float64
+	stddev float64 // sample standard deviation
+}
+
+func newStats(values []float64) stats {
+	MustBe(len(values) > 0)
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	mean := sum / float64(len(sorted))
+	var stddev float64
+	if len(sorted) > 1 {
+		var sq float64
+		for _, v := range sorted {
+			sq += (v - mean) * (v - mean)
+		}
+		stddev = math.Sqrt(sq / float64(len(sorted)-1))
+	}
+	return stats{
+		min:    sorted[0],
+		max:    sorted[len(sorted)-1],
+		median: percentile(sorted, 50),
+		mean:   mean,
+		p95:    percentile(sorted, 95),
+		stddev: stddev,
+	}
+}
+
+// Median returns the median of values, which must not be empty.
+func Median(values []float64) float64 {
+	MustBe(len(values) > 0)
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	return percentile(sorted, 50)
+}
+
+// percentile returns the p-th percentile of sorted values, using linear
+// interpolation between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	frac := rank - float64(lo)
+	return sorted[lo] + frac*(sorted[hi]-sorted[lo])
+}
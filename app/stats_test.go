@@ -0,0 +1,83 @@
+package app
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{[]float64{7}, 50, 7},
+		{[]float64{7}, 95, 7},
+		{[]float64{1, 2}, 50, 1.5},
+		{[]float64{1, 2, 3}, 50, 2},
+		{[]float64{1, 2, 3, 4}, 50, 2.5},
+		{[]float64{1, 2, 3, 4}, 0, 1},
+		{[]float64{1, 2, 3, 4}, 100, 4},
+		{[]float64{10, 20, 30, 40, 50}, 95, 48},
+		{[]float64{10, 20, 30, 40, 50}, 25, 20},
+		{[]float64{10, 20, 30, 40, 50}, 30, 22},
+	}
+	for _, tt := range tests {
+		got := percentile(tt.sorted, tt.p)
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("percentile(%v, %g) = %g, want %g", tt.sorted, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestNewStats(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   stats
+	}{
+		{[]float64{5}, stats{min: 5, max: 5, median: 5, mean: 5, p95: 5, stddev: 0}},
+		{[]float64{3, 1}, stats{min: 1, max: 3, median: 2, mean: 2, p95: 2.9, stddev: math.Sqrt2}},
+		{[]float64{4, 2, 8, 6}, stats{min: 2, max: 8, median: 5, mean: 5, p95: 7.7, stddev: math.Sqrt(20.0 / 3)}},
+	}
+	for _, tt := range tests {
+		got := newStats(tt.values)
+		fields := []struct {
+			name      string
+			got, want float64
+		}{
+			{"min", got.min, tt.want.min},
+			{"max", got.max, tt.want.max},
+			{"median", got.median, tt.want.median},
+			{"mean", got.mean, tt.want.mean},
+			{"p95", got.p95, tt.want.p95},
+			{"stddev", got.stddev, tt.want.stddev},
+		}
+		for _, f := range fields {
+			if math.Abs(f.got-f.want) > 1e-9 {
+				t.Errorf("newStats(%v).%s = %g, want %g", tt.values, f.name, f.got, f.want)
+			}
+		}
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{[]float64{42}, 42},
+		{[]float64{3, 1, 2}, 2},
+		{[]float64{4, 1, 3, 2}, 2.5},
+	}
+	for _, tt := range tests {
+		values := append([]float64(nil), tt.values...)
+		if got := Median(values); got != tt.want {
+			t.Errorf("Median(%v) = %g, want %g", tt.values, got, tt.want)
+		}
+		for i := range values {
+			if values[i] != tt.values[i] {
+				t.Fatalf("Median(%v) modified its input to %v", tt.values, values)
+			}
+		}
+	}
+}
@@ -2,28 +2,18 @@ package app
 
 import (
 	"fmt"
+	"log"
 	"os"
-	"time"
+	"strconv"
+	"strings"
 )
 
-func Must(c bool, format string, a ...any) {
-	if !c {
-		panic(fmt.Sprintf("fail: "+format, a...))
-	}
-}
-
 func MustBe(c bool) {
 	if !c {
 		panic("must be true but was false")
 	}
 }
 
-func MustBeEqual(a, b any) {
-	if a != b {
-		panic(fmt.Sprintf("must be equal but was different: %#v != %#v", a, b))
-	}
-}
-
 func MustBeNil(a any) {
 	if a != nil {
 		panic(fmt.Sprintf("must be nil but was %#v", a))
@@ -58,6 +48,29 @@ func dbsize(dbfile string) int64 {
 	return total
 }
 
-func millisSince(t time.Time) int64 {
-	return time.Since(t).Milliseconds()
+// SplitList splits a comma-separated list, trimming spaces and ignoring
+// empty elements.
+func SplitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// mustParseInts parses a comma-separated list of ints not less than minValue
+// from a command-line flag and exits if the list is malformed.
+func mustParseInts(flagName string, s string, minValue int) []int {
+	var ints []int
+	for _, item := range SplitList(s) {
+		n, err := strconv.Atoi(item)
+		if err != nil || n < minValue {
+			log.Fatalf("invalid %s %q, must be comma-separated integers >= %d", flagName, s, minValue)
+		}
+		ints = append(ints, n)
+	}
+	return ints
 }
@@ -0,0 +1,264 @@
+// Command bench-compare compares two result files, as written by
+// bench-runner, e.g. before and after a driver upgrade. It prints the
+// change of each measurement and exits with status 1 if a measurement
+// regressed by more than a threshold (got slower or larger, or for rates
+// and counts of successes, smaller), failed in the new file but not in the
+// old file, or is missing from the new file.
+//
+// If both files contain more than one value for a measurement (from
+// multiple iterations or rounds), a Mann-Whitney U test tells whether the
+// change is statistically significant. Changes that are not significant
+// are not considered regressions. If there are too few values for the test
+// to ever reach the significance level, for example 2+2 values at the
+// default level of 0.05, the threshold alone decides and a warning is
+// printed.
+//
+//	go run ./cmd/bench-compare -threshold 10 old.jsonl new.jsonl
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/cvilsmeier/go-sqlite-bench/app"
+)
+
+func main() {
+	log.SetFlags(0)
+	thresholdFlag := flag.Float64("threshold", 10, "regression threshold in percent")
+	alphaFlag := flag.Float64("alpha", 0.05, "significance level")
+	unitFlag := flag.String("unit", "ns", "unit of the measurements to compare, e.g. ns, ns/row or B")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] old.jsonl new.jsonl\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	old := load(flag.Arg(0), *unitFlag)
+	new := load(flag.Arg(1), *unitFlag)
+	// compare measurements of the old file, and failures of the new file
+	var keys []key
+	for k := range old.values {
+		keys = append(keys, k)
+	}
+	for k := range new.errors {
+		if _, ok := old.values[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "benchmark\tphase\tdriver\told\tnew\tdelta\tp\tn\t\n")
+	var regressions, untestable int
+	var failures []string
+	for _, k := range keys {
+		x, y := old.values[k], new.values[k]
+		if msg, ok := new.errors[k]; ok {
+			if _, failedBefore := old.errors[k]; failedBefore {
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t-\t%d+%d\t\n",
+				k.label(), k.phase, k.driver, formatMedian(x, k.unit), "failed", "!", len(x), len(y))
+			failures = append(failures, fmt.Sprintf("%s %s %s: %s", k.label(), k.phase, k.driver, msg))
+			regressions++
+			continue
+		}
+		if len(y) == 0 {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t-\t%d+%d\t\n",
+				k.label(), k.phase, k.driver, formatMedian(x, k.unit), "missing", "!", len(x), len(y))
+			regressions++
+			continue
+		}
+		mx, my := app.Median(x), app.Median(y)
+		delta := math.NaN()
+		if mx != 0 {
+			delta = (my - mx) / mx * 100
+		}
+		pstr := "-"
+		significant := true
+		switch {
+		case len(x) > 1 && len(y) > 1 && minPValue(len(x), len(y)) <= *alphaFlag:
+			p := mannWhitney(x, y)
+			pstr = fmt.Sprintf("%.3f", p)
+			significant = p <= *alphaFlag
+		case len(x) > 1 && len(y) > 1:
+			pstr = "?"
+			untestable++
+		}
+		// for rates and counts of successes, a decrease is a regression
+		worse := delta
+		if app.HigherIsBetter(k.unit) {
+			worse = -delta
+		}
+		mark := ""
+		switch {
+		case !significant:
+			mark = " ~"
+		case worse > *thresholdFlag:
+			mark = " !"
+			regressions++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%+.2f%%%s\t%s\t%d+%d\t\n",
+			k.label(), k.phase, k.driver, format(mx, k.unit), format(my, k.unit), delta, mark, pstr, len(x), len(y))
+	}
+	tw.Flush()
+	fmt.Printf("\n~ not significant (p > %g), ! regression (worse by > %g%%, failed or missing), ? too few values for a significance test\n", *alphaFlag, *thresholdFlag)
+	for _, f := range failures {
+		fmt.Printf("failed: %s\n", f)
+	}
+	if untestable > 0 {
+		log.Printf("warning: %d measurement(s) have too few values to reach p <= %g, only the threshold was applied; use more rounds or iterations", untestable, *alphaFlag)
+	}
+	if regressions > 0 {
+		fmt.Printf("%d regression(s)\n", regressions)
+		os.Exit(1)
+	}
+}
+
+// key identifies a measurement across iterations and rounds.
+type key struct {
+	benchmark   string
+	parameter   int
+	phase       string
+	driver      string
+	unit        string
+	journalMode string
+	synchronous string
+}
+
+func (k key) label() string {
+	if k.parameter == 0 {
+		return fmt.Sprintf("%s %s/%s", k.benchmark, k.journalMode, k.synchronous)
+	}
+	return fmt.Sprintf("%s/N=%d %s/%s", k.benchmark, k.parameter, k.journalMode, k.synchronous)
+}
+
+func (k key) less(o key) bool {
+	if k.benchmark != o.benchmark {
+		return k.benchmark < o.benchmark
+	}
+	if k.parameter != o.parameter {
+		return k.parameter < o.parameter
+	}
+	if k.journalMode != o.journalMode {
+		return k.journalMode < o.journalMode
+	}
+	if k.synchronous != o.synchronous {
+		return k.synchronous < o.synchronous
+	}
+	if k.phase != o.phase {
+		return k.phase < o.phase
+	}
+	return k.driver < o.driver
+}
+
+// results holds the values and failures of a result file.
+type results struct {
+	values map[key][]float64
+	errors map[key]string // error message of a failed measurement
+}
+
+// load reads all values of a given unit, and all failures, from a result file.
+// Failures are keyed by the given unit, so that they match the values that
+// are missing because of them.
+func load(filename string, unit string) results {
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	records, err := app.ReadRecords(f)
+	if err != nil {
+		log.Fatalf("cannot read %s: %s", filename, err)
+	}
+	res := results{make(map[key][]float64), make(map[key]string)}
+	for _, r := range records {
+		k := key{r.Benchmark, r.Parameter, r.Phase, r.Driver, unit, r.JournalMode, r.Synchronous}
+		switch {
+		case r.Error != "":
+			res.errors[k] = r.Error
+		case r.Unit == unit:
+			res.values[k] = append(res.values[k], r.Value)
+		}
+	}
+	return res
+}
+
+// format formats a value, durations in milliseconds.
+func format(v float64, unit string) string {
+	if unit == "ns" {
+		return fmt.Sprintf("%.3fms", v/1e6)
+	}
+	return fmt.Sprintf("%.0f%s", v, unit)
+}
+
+// formatMedian formats the median of values, "-" if there are none.
+func formatMedian(values []float64, unit string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return format(app.Median(values), unit)
+}
+
+// mannWhitney returns the two-sided p-value of the Mann-Whitney U test for
+// the samples x and y, using the normal approximation with tie correction.
+func mannWhitney(x, y []float64) float64 {
+	type sample struct {
+		v     float64
+		fromX bool
+	}
+	var all []sample
+	for _, v := range x {
+		all = append(all, sample{v, true})
+	}
+	for _, v := range y {
+		all = append(all, sample{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+	// rank samples, ties get the average rank
+	n := float64(len(all))
+	var rx, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // 1-based average rank of i..j-1
+		for k := i; k < j; k++ {
+			if all[k].fromX {
+				rx += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+	nx, ny := float64(len(x)), float64(len(y))
+	u := rx - nx*(nx+1)/2
+	mu := nx * ny / 2
+	sigma := math.Sqrt(nx * ny / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (math.Abs(u-mu) - 0.5) / sigma // with continuity correction
+	return math.Min(1, math.Erfc(math.Max(0, z)/math.Sqrt2))
+}
+
+// minPValue returns the smallest two-sided p-value that the exact
+// Mann-Whitney U test can reach for samples of size nx and ny, which is
+// when the samples do not overlap: 2 / binomial(nx+ny, nx).
+func minPValue(nx, ny int) float64 {
+	c := 1.0
+	for i := 1; i <= nx; i++ {
+		c = c * float64(ny+i) / float64(i)
+	}
+	return math.Min(1, 2/c)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMannWhitney(t *testing.T) {
+	tests := []struct {
+		name string
+		x, y []float64
+		want float64
+	}{
+		// p-values of the normal approximation with tie and continuity
+		// correction, the method of R's wilcox.test(x, y, exact=FALSE)
+		{"disjoint", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 0.012186},
+		{"disjoint swapped", []float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 0.012186},
+		{"overlapping", []float64{10, 11, 12, 13, 14, 15}, []float64{12, 13, 14, 15, 16, 17, 18}, 0.072557},
+		{"ties", []float64{1, 2, 2, 3, 4}, []float64{2, 3, 3, 5, 6}, 0.198829},
+		{"identical", []float64{1, 2, 3}, []float64{1, 2, 3}, 1},
+		{"all equal", []float64{5, 5, 5}, []float64{5, 5}, 1},
+		{"2+2", []float64{1, 2}, []float64{3, 4}, 0.245278},
+	}
+	for _, tt := range tests {
+		got := mannWhitney(tt.x, tt.y)
+		if math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("%s: mannWhitney(%v, %v) = %.6f, want %.6f", tt.name, tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestMinPValue(t *testing.T) {
+	tests := []struct {
+		nx, ny int
+		want   float64
+	}{
+		{1, 1, 1},
+		{2, 2, 1.0 / 3},
+		{2, 3, 0.2},
+		{3, 3, 0.1},
+		{5, 5, 2.0 / 252},
+		{10, 10, 2.0 / 184756},
+	}
+	for _, tt := range tests {
+		got := minPValue(tt.nx, tt.ny)
+		if math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("minPValue(%d, %d) = %g, want %g", tt.nx, tt.ny, got, tt.want)
+		}
+		if got != minPValue(tt.ny, tt.nx) {
+			t.Errorf("minPValue(%d, %d) is not symmetric", tt.nx, tt.ny)
+		}
+	}
+	// with 2 values on each side, no difference can be significant at the
+	// default level, so compare must fall back to the threshold
+	if p := minPValue(2, 2); p <= 0.05 {
+		t.Errorf("minPValue(2, 2) = %g, want > 0.05", p)
+	}
+}
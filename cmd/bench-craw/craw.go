@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 
 	"crawshaw.io/sqlite"
 	"crawshaw.io/sqlite/sqlitex"
@@ -9,156 +10,289 @@ import (
 )
 
 func main() {
-	app.Run(func(dbfile string) app.Db {
+	app.Run(func(dbfile string) (app.Db, error) {
 		return newDb(dbfile)
 	})
 }
 
+// dbImpl prepares statements with Conn.Prepare, which caches them per
+// connection. Insert and query methods reset their statement when done
+// instead of finalizing it, so that repeated calls reuse the cached
+// statement.
 type dbImpl struct {
 	pool *sqlitex.Pool
 }
 
 var _ app.Db = (*dbImpl)(nil)
 
-func newDb(dbfile string) app.Db {
+func newDb(dbfile string) (app.Db, error) {
 	flags := sqlite.SQLITE_OPEN_READWRITE |
 		sqlite.SQLITE_OPEN_CREATE |
 		sqlite.SQLITE_OPEN_URI |
 		sqlite.SQLITE_OPEN_NOMUTEX
 	const poolSize = 1
 	pool, err := sqlitex.Open(dbfile, flags, poolSize)
-	app.MustBeNil(err)
-	return &dbImpl{pool}
+	if err != nil {
+		return nil, err
+	}
+	return &dbImpl{pool}, nil
 }
 
 func (d *dbImpl) DriverName() string {
 	return "craw"
 }
 
-func (d *dbImpl) Exec(sqls ...string) {
-	conn := d.pool.Get(context.TODO())
+func (d *dbImpl) SqliteVersion(ctx context.Context) (string, error) {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return "", err
+	}
 	defer d.pool.Put(conn)
-	app.MustBeSet(conn)
-	for _, s := range sqls {
-		d.exec(conn, s)
+	texts, err := d.queryTexts(conn, "SELECT sqlite_version()")
+	if err != nil {
+		return "", err
 	}
+	return texts[0], nil
 }
 
-func (d *dbImpl) InsertUsers(insertSql string, users []app.User) {
-	conn := d.pool.Get(context.TODO())
+func (d *dbImpl) CompileOptions(ctx context.Context) ([]string, error) {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer d.pool.Put(conn)
-	d.exec(conn, "BEGIN")
-	stmt := conn.Prep(insertSql)
-	for _, u := range users {
-		//	Id        int
-		//	Created   time.Time
-		//	Email     string
-		//	Active    bool
-		stmt.BindInt64(1, int64(u.Id))
-		stmt.BindInt64(2, app.BindTime(u.Created))
-		stmt.BindText(3, u.Email)
-		stmt.BindBool(4, u.Active)
-		_, err := stmt.Step()
-		app.MustBeNil(err)
-		err = stmt.Reset()
-		app.MustBeNil(err)
+	return d.queryTexts(conn, "PRAGMA compile_options")
+}
+
+func (d *dbImpl) Exec(ctx context.Context, sqls ...string) error {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return err
 	}
-	err := stmt.Finalize()
-	app.MustBeNil(err)
-	d.exec(conn, "COMMIT")
+	defer d.pool.Put(conn)
+	for _, s := range sqls {
+		err := d.exec(conn, s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (d *dbImpl) InsertArticles(insertSql string, articles []app.Article) {
-	conn := d.pool.Get(context.TODO())
+func (d *dbImpl) InsertUsers(ctx context.Context, insertSql string, users []app.User) error {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return err
+	}
 	defer d.pool.Put(conn)
-	d.exec(conn, "BEGIN")
-	stmt := conn.Prep(insertSql)
-	for _, u := range articles {
-		stmt.BindInt64(1, int64(u.Id))
-		stmt.BindInt64(2, app.BindTime(u.Created))
-		stmt.BindInt64(3, int64(u.UserId))
-		stmt.BindText(4, u.Text)
-		_, err := stmt.Step()
-		app.MustBeNil(err)
-		err = stmt.Reset()
-		app.MustBeNil(err)
+	return d.tx(conn, func() error {
+		stmt, err := conn.Prepare(insertSql)
+		if err != nil {
+			return err
+		}
+		defer stmt.Reset()
+		for _, u := range users {
+			//	Id        int
+			//	Created   time.Time
+			//	Email     string
+			//	Active    bool
+			stmt.BindInt64(1, int64(u.Id))
+			stmt.BindInt64(2, app.BindTime(u.Created))
+			stmt.BindText(3, u.Email)
+			stmt.BindBool(4, u.Active)
+			_, err = stmt.Step()
+			if err != nil {
+				return err
+			}
+			err = stmt.Reset()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *dbImpl) InsertArticles(ctx context.Context, insertSql string, articles []app.Article) error {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return err
 	}
-	err := stmt.Finalize()
-	app.MustBeNil(err)
-	d.exec(conn, "COMMIT")
+	defer d.pool.Put(conn)
+	return d.tx(conn, func() error {
+		stmt, err := conn.Prepare(insertSql)
+		if err != nil {
+			return err
+		}
+		defer stmt.Reset()
+		for _, u := range articles {
+			stmt.BindInt64(1, int64(u.Id))
+			stmt.BindInt64(2, app.BindTime(u.Created))
+			stmt.BindInt64(3, int64(u.UserId))
+			stmt.BindText(4, u.Text)
+			_, err = stmt.Step()
+			if err != nil {
+				return err
+			}
+			err = stmt.Reset()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (d *dbImpl) InsertComments(insertSql string, comments []app.Comment) {
-	conn := d.pool.Get(context.TODO())
+func (d *dbImpl) InsertComments(ctx context.Context, insertSql string, comments []app.Comment) error {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return err
+	}
 	defer d.pool.Put(conn)
-	d.exec(conn, "BEGIN")
-	stmt := conn.Prep(insertSql)
-	for _, u := range comments {
-		stmt.BindInt64(1, int64(u.Id))
-		stmt.BindInt64(2, app.BindTime(u.Created))
-		stmt.BindInt64(3, int64(u.ArticleId))
-		stmt.BindText(4, u.Text)
-		_, err := stmt.Step()
-		app.MustBeNil(err)
-		err = stmt.Reset()
-		app.MustBeNil(err)
+	return d.tx(conn, func() error {
+		stmt, err := conn.Prepare(insertSql)
+		if err != nil {
+			return err
+		}
+		defer stmt.Reset()
+		for _, u := range comments {
+			stmt.BindInt64(1, int64(u.Id))
+			stmt.BindInt64(2, app.BindTime(u.Created))
+			stmt.BindInt64(3, int64(u.ArticleId))
+			stmt.BindText(4, u.Text)
+			_, err = stmt.Step()
+			if err != nil {
+				return err
+			}
+			err = stmt.Reset()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *dbImpl) UpdateUsers(ctx context.Context, updateSql string, users []app.User) error {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer d.pool.Put(conn)
+	return d.tx(conn, func() error {
+		stmt, err := conn.Prepare(updateSql)
+		if err != nil {
+			return err
+		}
+		defer stmt.Reset()
+		for _, u := range users {
+			stmt.BindInt64(1, app.BindTime(u.Created))
+			stmt.BindText(2, u.Email)
+			stmt.BindBool(3, u.Active)
+			stmt.BindInt64(4, int64(u.Id))
+			_, err = stmt.Step()
+			if err != nil {
+				return err
+			}
+			err = stmt.Reset()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *dbImpl) DeleteByIds(ctx context.Context, deleteSql string, ids []int) error {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return err
 	}
-	err := stmt.Finalize()
-	app.MustBeNil(err)
-	d.exec(conn, "COMMIT")
+	defer d.pool.Put(conn)
+	return d.tx(conn, func() error {
+		stmt, err := conn.Prepare(deleteSql)
+		if err != nil {
+			return err
+		}
+		defer stmt.Reset()
+		for _, id := range ids {
+			stmt.BindInt64(1, int64(id))
+			_, err = stmt.Step()
+			if err != nil {
+				return err
+			}
+			err = stmt.Reset()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (d *dbImpl) FindUsers(querySql string) []app.User {
-	conn := d.pool.Get(context.TODO())
+func (d *dbImpl) FindUsers(ctx context.Context, querySql string) ([]app.User, error) {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer d.pool.Put(conn)
 	stmt, err := conn.Prepare(querySql)
-	app.MustBeNil(err)
-	more, err := stmt.Step()
-	app.MustBeNil(err)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Reset()
 	var users []app.User
-	for more {
-		user := app.NewUser(
-			stmt.ColumnInt(0),                   // id,
-			app.UnbindTime(stmt.ColumnInt64(1)), // created,
-			stmt.ColumnText(2),                  // email,
-			stmt.ColumnInt(3) != 0,              // active,
-		)
+	for {
+		more, err := stmt.Step()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+		user := readUser(stmt, 0)
 		users = append(users, user)
-		more, err = stmt.Step()
-		app.MustBeNil(err)
 	}
-	return users
+	return users, nil
 }
 
-func (d *dbImpl) FindArticles(querySql string) []app.Article {
-	conn := d.pool.Get(context.TODO())
+func (d *dbImpl) FindArticles(ctx context.Context, querySql string) ([]app.Article, error) {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer d.pool.Put(conn)
 	stmt, err := conn.Prepare(querySql)
-	app.MustBeNil(err)
-	more, err := stmt.Step()
-	app.MustBeNil(err)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Reset()
 	var articles []app.Article
-	for more {
-		article := app.NewArticle(
-			stmt.ColumnInt(0),                   // id,
-			app.UnbindTime(stmt.ColumnInt64(1)), // created,
-			stmt.ColumnInt(2),                   // userId,
-			stmt.ColumnText(3),                  // text,
-		)
+	for {
+		more, err := stmt.Step()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+		article := readArticle(stmt, 0)
 		articles = append(articles, article)
-		more, err = stmt.Step()
-		app.MustBeNil(err)
 	}
-	return articles
+	return articles, nil
 }
 
-func (d *dbImpl) FindUsersArticlesComments(querySql string) ([]app.User, []app.Article, []app.Comment) {
-	conn := d.pool.Get(context.TODO())
+func (d *dbImpl) FindUsersArticlesComments(ctx context.Context, querySql string) ([]app.User, []app.Article, []app.Comment, error) {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	defer d.pool.Put(conn)
 	stmt, err := conn.Prepare(querySql)
-	app.MustBeNil(err)
-	more, err := stmt.Step()
-	app.MustBeNil(err)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer stmt.Reset()
 	// collections
 	var users []app.User
 	userIndexer := make(map[int]int)
@@ -166,25 +300,17 @@ func (d *dbImpl) FindUsersArticlesComments(querySql string) ([]app.User, []app.A
 	articleIndexer := make(map[int]int)
 	var comments []app.Comment
 	commentIndexer := make(map[int]int)
-	for more {
-		user := app.NewUser(
-			stmt.ColumnInt(0),                   // id,
-			app.UnbindTime(stmt.ColumnInt64(1)), // created,
-			stmt.ColumnText(2),                  // email,
-			stmt.ColumnInt(3) != 0,              // active,
-		)
-		article := app.NewArticle(
-			stmt.ColumnInt(4),                   // id,
-			app.UnbindTime(stmt.ColumnInt64(5)), // created,
-			stmt.ColumnInt(6),                   // userId,
-			stmt.ColumnText(7),                  // text,
-		)
-		comment := app.NewComment(
-			stmt.ColumnInt(8),                   // id,
-			app.UnbindTime(stmt.ColumnInt64(9)), // created,
-			stmt.ColumnInt(10),                  // articleId,
-			stmt.ColumnText(11),                 // text,
-		)
+	for {
+		more, err := stmt.Step()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if !more {
+			break
+		}
+		user := readUser(stmt, 0)
+		article := readArticle(stmt, 4)
+		comment := readComment(stmt, 8)
 		_, ok := userIndexer[user.Id]
 		if !ok {
 			userIndexer[user.Id] = len(users)
@@ -200,21 +326,189 @@ func (d *dbImpl) FindUsersArticlesComments(querySql string) ([]app.User, []app.A
 			commentIndexer[comment.Id] = len(comments)
 			comments = append(comments, comment)
 		}
-		more, err = stmt.Step()
-		app.MustBeNil(err)
 	}
-	return users, articles, comments
+	return users, articles, comments, nil
+}
+
+func (d *dbImpl) ScanUsers(ctx context.Context, querySql string, fn func(app.User) error) error {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer d.pool.Put(conn)
+	stmt, err := conn.Prepare(querySql)
+	if err != nil {
+		return err
+	}
+	defer stmt.Reset()
+	for {
+		more, err := stmt.Step()
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+		err = fn(readUser(stmt, 0))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *dbImpl) ScanUsersArticlesComments(ctx context.Context, querySql string, fn func(app.User, app.Article, app.Comment) error) error {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer d.pool.Put(conn)
+	stmt, err := conn.Prepare(querySql)
+	if err != nil {
+		return err
+	}
+	defer stmt.Reset()
+	for {
+		more, err := stmt.Step()
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+		err = fn(readUser(stmt, 0), readArticle(stmt, 4), readComment(stmt, 8))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *dbImpl) FindUsersById(ctx context.Context, querySql string, ids []int, fn func(app.User) error) error {
+	conn, err := d.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer d.pool.Put(conn)
+	stmt, err := conn.Prepare(querySql)
+	if err != nil {
+		return err
+	}
+	defer stmt.Reset()
+	for _, id := range ids {
+		stmt.BindInt64(1, int64(id))
+		found, err := stmt.Step()
+		if err != nil {
+			return err
+		}
+		var user app.User
+		if found {
+			user = readUser(stmt, 0)
+		}
+		err = stmt.Reset()
+		if err != nil {
+			return err
+		}
+		if found {
+			err = fn(user)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *dbImpl) IsInterrupt(err error) bool {
+	return sqlite.ErrCode(err) == sqlite.SQLITE_INTERRUPT
+}
+
+func (d *dbImpl) Close() error {
+	return d.pool.Close()
 }
 
-func (d *dbImpl) Close() {
-	err := d.pool.Close()
-	app.MustBeNil(err)
+func readUser(stmt *sqlite.Stmt, off int) app.User {
+	return app.NewUser(
+		stmt.ColumnInt(off+0),                   // id,
+		app.UnbindTime(stmt.ColumnInt64(off+1)), // created,
+		stmt.ColumnText(off+2),                  // email,
+		stmt.ColumnInt(off+3) != 0,              // active,
+	)
 }
 
-func (d *dbImpl) exec(conn *sqlite.Conn, sql string) {
-	stmt := conn.Prep(sql)
-	_, err := stmt.Step()
-	app.MustBeNil(err)
-	err = stmt.Finalize()
-	app.MustBeNil(err)
+func readArticle(stmt *sqlite.Stmt, off int) app.Article {
+	return app.NewArticle(
+		stmt.ColumnInt(off+0),                   // id,
+		app.UnbindTime(stmt.ColumnInt64(off+1)), // created,
+		stmt.ColumnInt(off+2),                   // userId,
+		stmt.ColumnText(off+3),                  // text,
+	)
+}
+
+func readComment(stmt *sqlite.Stmt, off int) app.Comment {
+	return app.NewComment(
+		stmt.ColumnInt(off+0),                   // id,
+		app.UnbindTime(stmt.ColumnInt64(off+1)), // created,
+		stmt.ColumnInt(off+2),                   // articleId,
+		stmt.ColumnText(off+3),                  // text,
+	)
+}
+
+// get takes a connection from the pool. Running statements of the
+// connection are interrupted when ctx is cancelled.
+func (d *dbImpl) get(ctx context.Context) (*sqlite.Conn, error) {
+	conn := d.pool.Get(ctx)
+	if conn == nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errors.New("pool closed")
+	}
+	return conn, nil
+}
+
+// queryTexts returns the first column of all rows of a query.
+func (d *dbImpl) queryTexts(conn *sqlite.Conn, sql string) ([]string, error) {
+	stmt, err := conn.Prepare(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Finalize()
+	var texts []string
+	for {
+		more, err := stmt.Step()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+		texts = append(texts, stmt.ColumnText(0))
+	}
+	return texts, nil
+}
+
+// tx runs f in a transaction, which is rolled back if f fails.
+func (d *dbImpl) tx(conn *sqlite.Conn, f func() error) error {
+	err := d.exec(conn, "BEGIN")
+	if err != nil {
+		return err
+	}
+	err = f()
+	if err != nil {
+		d.exec(conn, "ROLLBACK")
+		return err
+	}
+	return d.exec(conn, "COMMIT")
+}
+
+func (d *dbImpl) exec(conn *sqlite.Conn, sql string) error {
+	stmt, err := conn.Prepare(sql)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Step()
+	if err != nil {
+		stmt.Finalize()
+		return err
+	}
+	return stmt.Finalize()
 }
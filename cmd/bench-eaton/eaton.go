@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
+
 	"github.com/cvilsmeier/go-sqlite-bench/app"
 	"github.com/eatonphil/gosqlite"
 )
 
 func main() {
-	app.Run(func(dbfile string) app.Db {
+	app.Run(func(dbfile string) (app.Db, error) {
 		return newDb(dbfile)
 	})
 }
@@ -17,116 +20,263 @@ type dbImpl struct {
 
 var _ app.Db = (*dbImpl)(nil)
 
-func newDb(dbfile string) app.Db {
+func newDb(dbfile string) (app.Db, error) {
 	flags := gosqlite.OPEN_READWRITE |
 		gosqlite.OPEN_CREATE |
 		gosqlite.OPEN_URI |
 		gosqlite.OPEN_NOMUTEX
 	conn, err := gosqlite.Open(dbfile, flags)
-	app.MustBeNil(err)
-	return &dbImpl{conn}
+	if err != nil {
+		return nil, err
+	}
+	return &dbImpl{conn}, nil
 }
 
 func (d *dbImpl) DriverName() string {
 	return "eaton"
 }
 
-func (d *dbImpl) Exec(sqls ...string) {
-	for _, s := range sqls {
-		d.exec(s)
+func (d *dbImpl) SqliteVersion(ctx context.Context) (string, error) {
+	defer d.interrupt(ctx)()
+	texts, err := d.queryTexts("SELECT sqlite_version()")
+	if err != nil {
+		return "", err
 	}
+	return texts[0], nil
 }
 
-func (d *dbImpl) exec(sql string) {
-	err := d.conn.Exec(sql)
-	app.MustBeNil(err)
+func (d *dbImpl) CompileOptions(ctx context.Context) ([]string, error) {
+	defer d.interrupt(ctx)()
+	return d.queryTexts("PRAGMA compile_options")
 }
 
-func (d *dbImpl) prepare(sql string) *gosqlite.Stmt {
-	stmt, err := d.conn.Prepare(sql)
-	app.MustBeNil(err)
-	return stmt
+// interrupt interrupts running statements of the connection when ctx is
+// cancelled, until the returned function is called. If the interrupt has
+// already started, the returned function waits for it to finish, so that it
+// cannot hit the next statement or race with Close.
+func (d *dbImpl) interrupt(ctx context.Context) func() {
+	done := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(done)
+		d.conn.Interrupt()
+	})
+	return func() {
+		if !stop() {
+			<-done
+		}
+	}
 }
 
-func (d *dbImpl) InsertUsers(insertSql string, users []app.User) {
-	app.MustBeNil(d.conn.Begin())
-	stmt := d.prepare(insertSql)
-	for _, u := range users {
-		err := stmt.Exec(int64(u.Id), app.BindTime(u.Created), u.Email, u.Active)
-		app.MustBeNil(err)
+// queryTexts returns the first column of all rows of a query.
+func (d *dbImpl) queryTexts(sql string) ([]string, error) {
+	stmt, err := d.conn.Prepare(sql)
+	if err != nil {
+		return nil, err
 	}
-	app.MustBeNil(stmt.Close())
-	app.MustBeNil(d.conn.Commit())
+	defer stmt.Close()
+	var texts []string
+	for {
+		hasRow, err := stmt.Step()
+		if err != nil {
+			return nil, err
+		}
+		if !hasRow {
+			break
+		}
+		var text string
+		err = stmt.Scan(&text)
+		if err != nil {
+			return nil, err
+		}
+		texts = append(texts, text)
+	}
+	return texts, nil
 }
 
-func (d *dbImpl) InsertArticles(insertSql string, articles []app.Article) {
-	app.MustBeNil(d.conn.Begin())
-	stmt := d.prepare(insertSql)
-	for _, u := range articles {
-		err := stmt.Exec(int64(u.Id), app.BindTime(u.Created), int64(u.UserId), u.Text)
-		app.MustBeNil(err)
+func (d *dbImpl) Exec(ctx context.Context, sqls ...string) error {
+	defer d.interrupt(ctx)()
+	for _, s := range sqls {
+		err := d.conn.Exec(s)
+		if err != nil {
+			return err
+		}
 	}
-	app.MustBeNil(stmt.Close())
-	app.MustBeNil(d.conn.Commit())
+	return nil
 }
 
-func (d *dbImpl) InsertComments(insertSql string, comments []app.Comment) {
-	app.MustBeNil(d.conn.Begin())
-	stmt := d.prepare(insertSql)
-	for _, u := range comments {
-		err := stmt.Exec(int64(u.Id), app.BindTime(u.Created), int64(u.ArticleId), u.Text)
-		app.MustBeNil(err)
+// tx runs f in a transaction, which is rolled back if f fails.
+func (d *dbImpl) tx(f func() error) error {
+	err := d.conn.Begin()
+	if err != nil {
+		return err
 	}
-	app.MustBeNil(stmt.Close())
-	app.MustBeNil(d.conn.Commit())
+	err = f()
+	if err != nil {
+		d.conn.Rollback()
+		return err
+	}
+	return d.conn.Commit()
 }
 
-func (d *dbImpl) FindUsers(querySql string) []app.User {
-	app.MustBeNil(d.conn.Begin())
-	stmt := d.prepare(querySql)
+func (d *dbImpl) InsertUsers(ctx context.Context, insertSql string, users []app.User) error {
+	defer d.interrupt(ctx)()
+	return d.tx(func() error {
+		stmt, err := d.conn.Prepare(insertSql)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, u := range users {
+			err = stmt.Exec(int64(u.Id), app.BindTime(u.Created), u.Email, u.Active)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *dbImpl) InsertArticles(ctx context.Context, insertSql string, articles []app.Article) error {
+	defer d.interrupt(ctx)()
+	return d.tx(func() error {
+		stmt, err := d.conn.Prepare(insertSql)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, u := range articles {
+			err = stmt.Exec(int64(u.Id), app.BindTime(u.Created), int64(u.UserId), u.Text)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *dbImpl) InsertComments(ctx context.Context, insertSql string, comments []app.Comment) error {
+	defer d.interrupt(ctx)()
+	return d.tx(func() error {
+		stmt, err := d.conn.Prepare(insertSql)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, u := range comments {
+			err = stmt.Exec(int64(u.Id), app.BindTime(u.Created), int64(u.ArticleId), u.Text)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *dbImpl) UpdateUsers(ctx context.Context, updateSql string, users []app.User) error {
+	defer d.interrupt(ctx)()
+	return d.tx(func() error {
+		stmt, err := d.conn.Prepare(updateSql)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, u := range users {
+			err = stmt.Exec(app.BindTime(u.Created), u.Email, u.Active, int64(u.Id))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *dbImpl) DeleteByIds(ctx context.Context, deleteSql string, ids []int) error {
+	defer d.interrupt(ctx)()
+	return d.tx(func() error {
+		stmt, err := d.conn.Prepare(deleteSql)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, id := range ids {
+			err = stmt.Exec(int64(id))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *dbImpl) FindUsers(ctx context.Context, querySql string) ([]app.User, error) {
+	defer d.interrupt(ctx)()
 	var users []app.User
-	for {
-		hasRow, err := stmt.Step()
-		app.MustBeNil(err)
-		if !hasRow {
-			break
+	err := d.tx(func() error {
+		stmt, err := d.conn.Prepare(querySql)
+		if err != nil {
+			return err
 		}
-		var user app.User
-		var createdInt int64
-		err = stmt.Scan(&user.Id, &createdInt, &user.Email, &user.Active)
-		app.MustBeNil(err)
-		user.Created = app.UnbindTime(createdInt)
-		users = append(users, user)
-	}
-	app.MustBeNil(stmt.Close())
-	app.MustBeNil(d.conn.Commit())
-	return users
+		defer stmt.Close()
+		for {
+			hasRow, err := stmt.Step()
+			if err != nil {
+				return err
+			}
+			if !hasRow {
+				break
+			}
+			var user app.User
+			var createdInt int64
+			err = stmt.Scan(&user.Id, &createdInt, &user.Email, &user.Active)
+			if err != nil {
+				return err
+			}
+			user.Created = app.UnbindTime(createdInt)
+			users = append(users, user)
+		}
+		return nil
+	})
+	return users, err
 }
 
-func (d *dbImpl) FindArticles(querySql string) []app.Article {
-	app.MustBeNil(d.conn.Begin())
-	stmt := d.prepare(querySql)
+func (d *dbImpl) FindArticles(ctx context.Context, querySql string) ([]app.Article, error) {
+	defer d.interrupt(ctx)()
 	var articles []app.Article
-	for {
-		hasRow, err := stmt.Step()
-		app.MustBeNil(err)
-		if !hasRow {
-			break
+	err := d.tx(func() error {
+		stmt, err := d.conn.Prepare(querySql)
+		if err != nil {
+			return err
 		}
-		var article app.Article
-		var createdInt int64
-		err = stmt.Scan(&article.Id, &createdInt, &article.UserId, &article.Text)
-		app.MustBeNil(err)
-		article.Created = app.UnbindTime(createdInt)
-		articles = append(articles, article)
-	}
-	app.MustBeNil(stmt.Close())
-	app.MustBeNil(d.conn.Commit())
-	return articles
+		defer stmt.Close()
+		for {
+			hasRow, err := stmt.Step()
+			if err != nil {
+				return err
+			}
+			if !hasRow {
+				break
+			}
+			var article app.Article
+			var createdInt int64
+			err = stmt.Scan(&article.Id, &createdInt, &article.UserId, &article.Text)
+			if err != nil {
+				return err
+			}
+			article.Created = app.UnbindTime(createdInt)
+			articles = append(articles, article)
+		}
+		return nil
+	})
+	return articles, err
 }
 
-func (d *dbImpl) FindUsersArticlesComments(querySql string) ([]app.User, []app.Article, []app.Comment) {
-	stmt := d.prepare(querySql)
+func (d *dbImpl) FindUsersArticlesComments(ctx context.Context, querySql string) ([]app.User, []app.Article, []app.Comment, error) {
+	defer d.interrupt(ctx)()
+	stmt, err := d.conn.Prepare(querySql)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer stmt.Close()
 	// collections
 	var users []app.User
 	userIndexer := make(map[int]int)
@@ -136,7 +286,9 @@ func (d *dbImpl) FindUsersArticlesComments(querySql string) ([]app.User, []app.A
 	commentIndexer := make(map[int]int)
 	for {
 		hasRow, err := stmt.Step()
-		app.MustBeNil(err)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 		if !hasRow {
 			break
 		}
@@ -149,7 +301,9 @@ func (d *dbImpl) FindUsersArticlesComments(querySql string) ([]app.User, []app.A
 			&article.Id, &articleCreated, &article.UserId, &article.Text,
 			&comment.Id, &commentCreated, &comment.ArticleId, &comment.Text,
 		)
-		app.MustBeNil(err)
+		if err != nil {
+			return nil, nil, nil, err
+		}
 		user.Created = app.UnbindTime(userCreated)
 		article.Created = app.UnbindTime(articleCreated)
 		comment.Created = app.UnbindTime(commentCreated)
@@ -169,11 +323,121 @@ func (d *dbImpl) FindUsersArticlesComments(querySql string) ([]app.User, []app.A
 			comments = append(comments, comment)
 		}
 	}
-	app.MustBeNil(stmt.Close())
-	return users, articles, comments
+	return users, articles, comments, nil
+}
+
+func (d *dbImpl) ScanUsers(ctx context.Context, querySql string, fn func(app.User) error) error {
+	defer d.interrupt(ctx)()
+	return d.tx(func() error {
+		stmt, err := d.conn.Prepare(querySql)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for {
+			hasRow, err := stmt.Step()
+			if err != nil {
+				return err
+			}
+			if !hasRow {
+				return nil
+			}
+			var user app.User
+			var createdInt int64
+			err = stmt.Scan(&user.Id, &createdInt, &user.Email, &user.Active)
+			if err != nil {
+				return err
+			}
+			user.Created = app.UnbindTime(createdInt)
+			err = fn(user)
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+func (d *dbImpl) ScanUsersArticlesComments(ctx context.Context, querySql string, fn func(app.User, app.Article, app.Comment) error) error {
+	defer d.interrupt(ctx)()
+	stmt, err := d.conn.Prepare(querySql)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for {
+		hasRow, err := stmt.Step()
+		if err != nil {
+			return err
+		}
+		if !hasRow {
+			return nil
+		}
+		var user app.User
+		var article app.Article
+		var comment app.Comment
+		var userCreated, articleCreated, commentCreated int64
+		err = stmt.Scan(
+			&user.Id, &userCreated, &user.Email, &user.Active,
+			&article.Id, &articleCreated, &article.UserId, &article.Text,
+			&comment.Id, &commentCreated, &comment.ArticleId, &comment.Text,
+		)
+		if err != nil {
+			return err
+		}
+		user.Created = app.UnbindTime(userCreated)
+		article.Created = app.UnbindTime(articleCreated)
+		comment.Created = app.UnbindTime(commentCreated)
+		err = fn(user, article, comment)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *dbImpl) FindUsersById(ctx context.Context, querySql string, ids []int, fn func(app.User) error) error {
+	defer d.interrupt(ctx)()
+	stmt, err := d.conn.Prepare(querySql)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, id := range ids {
+		err = stmt.Bind(int64(id))
+		if err != nil {
+			return err
+		}
+		found, err := stmt.Step()
+		if err != nil {
+			return err
+		}
+		var user app.User
+		if found {
+			var createdInt int64
+			err = stmt.Scan(&user.Id, &createdInt, &user.Email, &user.Active)
+			if err != nil {
+				return err
+			}
+			user.Created = app.UnbindTime(createdInt)
+		}
+		err = stmt.Reset()
+		if err != nil {
+			return err
+		}
+		if found {
+			err = fn(user)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *dbImpl) IsInterrupt(err error) bool {
+	var e *gosqlite.Error
+	return errors.As(err, &e) && e.Code() == gosqlite.INTERRUPT
 }
 
-func (d *dbImpl) Close() {
-	err := d.conn.Close()
-	app.MustBeNil(err)
+func (d *dbImpl) Close() error {
+	return d.conn.Close()
 }
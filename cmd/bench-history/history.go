@@ -0,0 +1,131 @@
+// Command bench-history shows the trend of a measurement over all runs in
+// a history database, as written by bench-runner -history.
+//
+//	go run ./cmd/bench-history -bench simple -phase query -driver mattn
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cvilsmeier/go-sqlite-bench/app"
+	_ "modernc.org/sqlite"
+)
+
+func main() {
+	log.SetFlags(0)
+	dbFlag := flag.String("db", "results/history.db", "history database")
+	benchFlag := flag.String("bench", "simple", "benchmark, e.g. many")
+	paramFlag := flag.Int("param", 0, "benchmark parameter, e.g. 100 for many/N=100")
+	phaseFlag := flag.String("phase", "query", "phase, e.g. insert")
+	driverFlag := flag.String("driver", "", "driver, empty for all drivers")
+	unitFlag := flag.String("unit", "ns", "unit, e.g. ns or B")
+	journalModeFlag := flag.String("journal-mode", app.DefaultJournalMode, "journal mode, e.g. WAL")
+	synchronousFlag := flag.String("synchronous", app.DefaultSynchronous, "synchronous setting, e.g. NORMAL")
+	flag.Parse()
+	journalMode := strings.ToUpper(*journalModeFlag)
+	synchronous := strings.ToUpper(*synchronousFlag)
+	if _, err := os.Stat(*dbFlag); err != nil {
+		log.Fatal(err)
+	}
+	db, err := sql.Open("sqlite", *dbFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	// databases of older runners lack the pragma, error and environment
+	// columns until the next bench-runner -history run migrates them
+	var migrated bool
+	err = db.QueryRow("SELECT (SELECT COUNT(*) FROM pragma_table_info('measurements') WHERE name IN ('journalMode', 'error'))" +
+		" + (SELECT COUNT(*) FROM pragma_table_info('binaries') WHERE name = 'sqliteVersion') = 3").Scan(&migrated)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !migrated {
+		log.Fatalf("%s has an old schema, append a run with bench-runner -history to migrate it", *dbFlag)
+	}
+	rows, err := db.Query("SELECT runs.id, runs.started, runs.gitCommit, runs.host,"+
+		" binaries.driver, binaries.goVersion, binaries.driverVersion, binaries.sqliteVersion, measurements.value"+
+		" FROM measurements"+
+		" JOIN runs ON runs.id = measurements.runId"+
+		" JOIN binaries ON binaries.runId = measurements.runId AND binaries.driver = measurements.driver"+
+		" WHERE measurements.benchmark = ? AND measurements.parameter = ? AND measurements.phase = ?"+
+		" AND measurements.unit = ? AND (? = '' OR measurements.driver = ?)"+
+		" AND measurements.journalMode = ? AND measurements.synchronous = ?"+
+		" AND measurements.error = ''"+ // failed measurements have no value
+		" ORDER BY binaries.driver, runs.started, runs.id",
+		*benchFlag, *paramFlag, *phaseFlag, *unitFlag, *driverFlag, *driverFlag, journalMode, synchronous)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// one trend point per driver and run, with the median of all values
+	type point struct {
+		runId         int64
+		started       time.Time
+		gitCommit     string
+		host          string
+		driver        string
+		goVersion     string
+		driverVersion string
+		sqliteVersion string
+		values        []float64
+	}
+	var points []*point
+	for rows.Next() {
+		var p point
+		var started int64
+		var value float64
+		err = rows.Scan(&p.runId, &started, &p.gitCommit, &p.host, &p.driver, &p.goVersion, &p.driverVersion, &p.sqliteVersion, &value)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if n := len(points); n > 0 && points[n-1].runId == p.runId && points[n-1].driver == p.driver {
+			points[n-1].values = append(points[n-1].values, value)
+			continue
+		}
+		p.started = app.UnbindTime(started)
+		p.values = []float64{value}
+		points = append(points, &p)
+	}
+	if err = rows.Err(); err != nil {
+		log.Fatal(err)
+	}
+	if len(points) == 0 {
+		log.Fatalf("no measurements found for %s/%d %s %s %s/%s", *benchFlag, *paramFlag, *phaseFlag, *unitFlag, journalMode, synchronous)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "driver\tstarted\tcommit\thost\tgo\tversion\tsqlite\tn\tmedian\tchange\n")
+	for i, p := range points {
+		m := app.Median(p.values)
+		change := ""
+		if i > 0 && points[i-1].driver == p.driver {
+			if prev := app.Median(points[i-1].values); prev != 0 {
+				change = fmt.Sprintf("%+.2f%%", (m-prev)/prev*100)
+			}
+		}
+		commit, dirty := strings.CutSuffix(p.gitCommit, "-dirty")
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if dirty {
+			commit += "-dirty"
+		}
+		value := fmt.Sprintf("%.0f %s", m, *unitFlag)
+		if *unitFlag == "ns" {
+			value = fmt.Sprintf("%.3f ms", m/1e6)
+		}
+		sqlite := p.sqliteVersion
+		if sqlite == "" {
+			sqlite = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			p.driver, p.started.Format(time.DateTime), commit, p.host, p.goVersion, p.driverVersion, sqlite, len(p.values), value, change)
+	}
+	tw.Flush()
+}
@@ -2,15 +2,23 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 
 	"github.com/cvilsmeier/go-sqlite-bench/app"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 func main() {
-	app.Run(func(dbfile string) app.Db {
+	app.Run(func(dbfile string) (app.Db, error) {
 		db, err := sql.Open("sqlite3", dbfile)
-		app.MustBeNil(err)
-		return app.NewSqlDb("mattn", db)
+		if err != nil {
+			return nil, err
+		}
+		return app.NewSqlDb("mattn", db, isInterrupt), nil
 	})
 }
+
+func isInterrupt(err error) bool {
+	var e sqlite3.Error
+	return errors.As(err, &e) && e.Code == sqlite3.ErrInterrupt
+}
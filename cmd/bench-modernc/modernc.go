@@ -2,15 +2,24 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 
 	"github.com/cvilsmeier/go-sqlite-bench/app"
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 func main() {
-	app.Run(func(dbfile string) app.Db {
+	app.Run(func(dbfile string) (app.Db, error) {
 		db, err := sql.Open("sqlite", dbfile)
-		app.MustBeNil(err)
-		return app.NewSqlDb("modernc", db)
+		if err != nil {
+			return nil, err
+		}
+		return app.NewSqlDb("modernc", db, isInterrupt), nil
 	})
 }
+
+func isInterrupt(err error) bool {
+	var e *sqlite.Error
+	return errors.As(err, &e) && e.Code() == sqlite3.SQLITE_INTERRUPT
+}
@@ -2,16 +2,24 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 
 	"github.com/cvilsmeier/go-sqlite-bench/app"
+	"github.com/ncruces/go-sqlite3"
 	_ "github.com/ncruces/go-sqlite3/driver"
 	_ "github.com/ncruces/go-sqlite3/embed"
 )
 
 func main() {
-	app.Run(func(dbfile string) app.Db {
+	app.Run(func(dbfile string) (app.Db, error) {
 		db, err := sql.Open("sqlite3", dbfile)
-		app.MustBeNil(err)
-		return app.NewSqlDb("ncruces", db)
+		if err != nil {
+			return nil, err
+		}
+		return app.NewSqlDb("ncruces", db, isInterrupt), nil
 	})
 }
+
+func isInterrupt(err error) bool {
+	return errors.Is(err, sqlite3.INTERRUPT)
+}
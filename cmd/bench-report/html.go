@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cvilsmeier/go-sqlite-bench/app"
+)
+
+// htmlPage is the data of the HTML report template.
+type htmlPage struct {
+	Generated string
+	Files     []string
+	Baseline  string
+	Pragmas   string // e.g. "journal_mode=DELETE synchronous=FULL"
+	Tables    []htmlTable
+	Envs      []app.Env // sorted by driver
+}
+
+type htmlTable struct {
+	Name    string
+	Columns []string
+	Rows    []htmlRow
+	Chart   template.HTML
+}
+
+type htmlRow struct {
+	Driver   string
+	Baseline bool
+	Cells    []htmlCell
+}
+
+type htmlCell struct {
+	Value    string // e.g. "560"
+	Relative string // speed relative to baseline, e.g. "1.94x"
+	Faster   bool   // faster than baseline
+	Slower   bool   // slower than baseline
+}
+
+// writeHtml writes a self-contained HTML report with a table and a chart
+// for each benchmark. Each value is compared to the value of the baseline
+// driver: a relative speed of 2x means twice as fast as the baseline.
+// The pragmas of the reported results and the environment of each driver,
+// including SQLite version and compile options, are listed, since they
+// explain many of the differences.
+func writeHtml(filename string, files []string, baseline string, journalMode, synchronous string, envs map[string]app.Env, tables []table) {
+	page := htmlPage{
+		Generated: time.Now().Format(time.RFC1123),
+		Files:     files,
+		Baseline:  baseline,
+		Pragmas:   fmt.Sprintf("journal_mode=%s synchronous=%s", journalMode, synchronous),
+	}
+	for _, env := range envs {
+		page.Envs = append(page.Envs, env)
+	}
+	sort.Slice(page.Envs, func(i, j int) bool { return page.Envs[i].Driver < page.Envs[j].Driver })
+	for _, t := range tables {
+		ht := htmlTable{
+			Name:    t.name,
+			Columns: t.columns,
+			Chart:   template.HTML(t.svg()),
+		}
+		base := -1
+		for i, driver := range t.drivers {
+			if driver == baseline {
+				base = i
+			}
+		}
+		for i, driver := range t.drivers {
+			row := htmlRow{Driver: driver, Baseline: i == base}
+			for j := range t.columns {
+				v := t.values[i][j]
+				cell := htmlCell{Value: "-"}
+				if !math.IsNaN(v) {
+					cell.Value = fmt.Sprintf("%.0f", v)
+				}
+				if base >= 0 && !math.IsNaN(v) && v > 0 && !math.IsNaN(t.values[base][j]) {
+					rel := t.values[base][j] / v
+					cell.Relative = fmt.Sprintf("%.2fx", rel)
+					cell.Faster = rel > 1.05
+					cell.Slower = rel < 0.95
+				}
+				row.Cells = append(row.Cells, cell)
+			}
+			ht.Rows = append(ht.Rows, row)
+		}
+		page.Tables = append(page.Tables, ht)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = htmlTemplate.Execute(f, page)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %s", filename)
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{"join": strings.Join}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Benchmarks for Golang SQLite Drivers</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 960px; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+tr.baseline { font-weight: bold; background: #f4f4f4; }
+.rel { color: #777; font-size: 85%; }
+.faster { color: #2a7a2a; }
+.slower { color: #b02a2a; }
+td.options { text-align: left; font-size: 85%; }
+</style>
+</head>
+<body>
+<h1>Benchmarks for Golang SQLite Drivers</h1>
+<p>Result times are measured in milliseconds, median of all iterations and rounds.
+Lower numbers indicate better performance.
+All results were measured with <b>{{.Pragmas}}</b>.
+{{- if .Baseline}} Relative speed is compared to <b>{{.Baseline}}</b>, higher is faster.{{end}}</p>
+{{range .Tables}}
+<h2>{{.Name}}</h2>
+<table>
+<tr><th>{{.Name}}</th>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{- range .Rows}}
+<tr{{if .Baseline}} class="baseline"{{end}}><td>{{.Driver}}</td>
+{{- range .Cells}}<td>{{.Value}}{{if .Relative}} <span class="rel{{if .Faster}} faster{{end}}{{if .Slower}} slower{{end}}">{{.Relative}}</span>{{end}}</td>{{end}}</tr>
+{{- end}}
+</table>
+{{.Chart}}
+{{end}}
+<h2>Environment</h2>
+<table>
+<tr><td>generated</td><td>{{.Generated}}</td></tr>
+<tr><td>pragmas</td><td>{{.Pragmas}}</td></tr>
+{{- range .Files}}
+<tr><td>result file</td><td>{{.}}</td></tr>
+{{- end}}
+</table>
+{{- if .Envs}}
+<h2>Drivers</h2>
+<table>
+<tr><th>driver</th><th>module</th><th>go</th><th>os/arch</th><th>gomaxprocs</th><th>cpu</th><th>kernel</th><th>sqlite</th><th>compile options</th></tr>
+{{- range .Envs}}
+<tr><td>{{.Driver}}</td><td>{{.DriverModule}} {{.DriverVersion}}</td><td>{{.GoVersion}}</td><td>{{.GOOS}}/{{.GOARCH}}</td><td>{{.GOMAXPROCS}}</td><td>{{.CPU}}</td><td>{{.Kernel}}</td><td>{{.SqliteVersion}}</td><td class="options">{{join .CompileOptions " "}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,130 @@
+// Command bench-report reads the json output of the benchmark binaries,
+// as written by bench-runner, and regenerates the results.csv file and the
+// result tables in README.md. Optionally, it renders the result tables
+// as SVG bar charts and as a self-contained HTML report.
+//
+//	go run ./cmd/bench-report results/out.jsonl
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cvilsmeier/go-sqlite-bench/app"
+)
+
+func main() {
+	log.SetFlags(0)
+	csvFlag := flag.String("csv", "results/results.csv", "csv file to write, empty to skip")
+	readmeFlag := flag.String("readme", "README.md", "README file to update, empty to skip")
+	svgFlag := flag.String("svg", "", "directory to write SVG charts into, empty to skip")
+	htmlFlag := flag.String("html", "", "HTML report file to write, empty to skip")
+	baselineFlag := flag.String("baseline", "mattn", "baseline driver for relative speed in the HTML report")
+	journalModeFlag := flag.String("journal-mode", app.DefaultJournalMode, "journal mode of the results to report")
+	synchronousFlag := flag.String("synchronous", app.DefaultSynchronous, "synchronous setting of the results to report")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [resultfile...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	filenames := flag.Args()
+	if len(filenames) == 0 {
+		filenames = []string{"results/out.jsonl"}
+	}
+	journalMode := strings.ToUpper(*journalModeFlag)
+	synchronous := strings.ToUpper(*synchronousFlag)
+	res := load(filenames, journalMode, synchronous)
+	tables := makeTables(res)
+	if *csvFlag != "" {
+		writeCsv(*csvFlag, tables)
+		log.Printf("wrote %s", *csvFlag)
+	}
+	if *readmeFlag != "" {
+		updateReadme(*readmeFlag, tables)
+		log.Printf("updated %s", *readmeFlag)
+	}
+	if *svgFlag != "" {
+		writeSvgs(*svgFlag, tables)
+	}
+	if *htmlFlag != "" {
+		writeHtml(*htmlFlag, filenames, *baselineFlag, journalMode, synchronous, res.envs, tables)
+	}
+}
+
+// key identifies a measurement across iterations and rounds.
+type key struct {
+	benchmark string
+	parameter int
+	phase     string
+	driver    string
+	unit      string
+}
+
+// results holds all values of all measurements.
+type results struct {
+	values  map[key][]float64
+	drivers []string           // sorted
+	envs    map[string]app.Env // by driver, last one wins
+}
+
+// load reads result files. Only records of the given journal mode and
+// synchronous setting are used.
+func load(filenames []string, journalMode string, synchronous string) *results {
+	res := &results{values: make(map[key][]float64), envs: make(map[string]app.Env)}
+	seen := make(map[string]bool)
+	for _, filename := range filenames {
+		f, err := os.Open(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		envs, records, err := app.ReadOutput(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("cannot read %s: %s", filename, err)
+		}
+		for _, env := range envs {
+			res.envs[env.Driver] = env
+		}
+		for _, r := range records {
+			if r.JournalMode != journalMode || r.Synchronous != synchronous {
+				continue
+			}
+			k := key{r.Benchmark, r.Parameter, r.Phase, r.Driver, r.Unit}
+			res.values[k] = append(res.values[k], r.Value)
+			if !seen[r.Driver] {
+				seen[r.Driver] = true
+				res.drivers = append(res.drivers, r.Driver)
+			}
+		}
+	}
+	sort.Strings(res.drivers)
+	return res
+}
+
+// median returns the median of all values of a measurement, and false if
+// there are no values.
+func (res *results) median(k key) (float64, bool) {
+	values := res.values[k]
+	if len(values) == 0 {
+		return 0, false
+	}
+	return app.Median(values), true
+}
+
+// parameters returns the sorted parameters of a benchmark.
+func (res *results) parameters(benchmark string) []int {
+	seen := make(map[int]bool)
+	var params []int
+	for k := range res.values {
+		if k.benchmark == benchmark && !seen[k.parameter] {
+			seen[k.parameter] = true
+			params = append(params, k.parameter)
+		}
+	}
+	sort.Ints(params)
+	return params
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// colors of the bars, one per driver.
+var colors = []string{
+	"#004586", "#ff420e", "#ffd320", "#579d1c", "#7e0021", "#83caff", "#314004", "#aecf00",
+}
+
+// chart geometry, in pixels
+const (
+	chartWidth   = 640
+	chartHeight  = 370
+	plotLeft     = 60
+	plotTop      = 55
+	plotRight    = 520
+	plotBottom   = 335
+	legendLeft   = 535
+	legendTop    = 120
+	legendHeight = 24
+)
+
+// writeSvgs writes one chart per table into dir, e.g. dir/many.svg.
+func writeSvgs(dir string, tables []table) {
+	for _, t := range tables {
+		filename := filepath.Join(dir, strings.ToLower(t.name)+".svg")
+		err := os.WriteFile(filename, []byte(t.svg()), 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("wrote %s", filename)
+	}
+}
+
+// svg renders a table as grouped bar chart, with one group per column and
+// one bar per driver.
+func (t table) svg() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="white"/>`+"\n", chartWidth, chartHeight)
+	fmt.Fprintf(&sb, `<text x="%d" y="30" font-size="16" text-anchor="middle">%s</text>`+"\n", chartWidth/2, html.EscapeString(t.name))
+	// y axis with grid lines
+	var maxValue float64
+	for _, row := range t.values {
+		for _, v := range row {
+			if !math.IsNaN(v) {
+				maxValue = max(maxValue, v)
+			}
+		}
+	}
+	step := tickStep(maxValue)
+	ymax := step * math.Max(1, math.Ceil(maxValue/step))
+	y := func(v float64) float64 {
+		return plotBottom - v/ymax*(plotBottom-plotTop)
+	}
+	for v := 0.0; v <= ymax+step/2; v += step {
+		fmt.Fprintf(&sb, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#b3b3b3"/>`+"\n", plotLeft, y(v), plotRight, y(v))
+		fmt.Fprintf(&sb, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%g</text>`+"\n", plotLeft-6, y(v), v)
+	}
+	// bars
+	groupWidth := float64(plotRight-plotLeft) / float64(len(t.columns))
+	barWidth := groupWidth * 0.8 / float64(max(1, len(t.drivers)))
+	for j, col := range t.columns {
+		x0 := plotLeft + float64(j)*groupWidth
+		for i := range t.drivers {
+			v := t.values[i][j]
+			if math.IsNaN(v) {
+				continue
+			}
+			x := x0 + groupWidth*0.1 + float64(i)*barWidth
+			fmt.Fprintf(&sb, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s %s: %.0f ms</title></rect>`+"\n",
+				x, y(v), barWidth, y(0)-y(v), colors[i%len(colors)], html.EscapeString(t.drivers[i]), html.EscapeString(col), v)
+		}
+		fmt.Fprintf(&sb, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n", x0+groupWidth/2, plotBottom+18, html.EscapeString(col))
+		if j > 0 {
+			fmt.Fprintf(&sb, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#b3b3b3"/>`+"\n", x0, plotBottom, x0, plotBottom+5)
+		}
+	}
+	fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="#b3b3b3"/>`+"\n",
+		plotLeft, plotTop, plotRight-plotLeft, plotBottom-plotTop)
+	// legend
+	for i, driver := range t.drivers {
+		ly := legendTop + i*legendHeight
+		fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/>`+"\n", legendLeft, ly, colors[i%len(colors)])
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" dominant-baseline="middle">%s</text>`+"\n", legendLeft+16, ly+5, html.EscapeString(driver))
+	}
+	sb.WriteString("</svg>\n")
+	return sb.String()
+}
+
+// tickStep returns a step of 1, 2, 2.5 or 5 times a power of ten, so that
+// there are about 5 ticks from 0 to maxValue.
+func tickStep(maxValue float64) float64 {
+	if maxValue <= 0 {
+		return 1
+	}
+	raw := maxValue / 5
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, f := range []float64{1, 2, 2.5, 5} {
+		if raw <= f*magnitude {
+			return f * magnitude
+		}
+	}
+	return 10 * magnitude
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+)
+
+// table is a result table, with one row per driver. Values are in
+// milliseconds, NaN if missing.
+type table struct {
+	name    string   // e.g. "Many"
+	columns []string // e.g. "query/N=10"
+	drivers []string
+	values  [][]float64 // values[driver][column]
+}
+
+// tableSpec describes how a table is made from the results of a benchmark.
+type tableSpec struct {
+	name      string // e.g. "Many"
+	benchmark string // e.g. "many"
+	pivot     bool   // one column per parameter instead of one per phase
+}
+
+var tableSpecs = []tableSpec{
+	{"Simple", "simple", false},
+	{"Complex", "complex", false},
+	{"Many", "many", true},
+	{"Large", "large", true},
+	{"Concurrent", "concurrent", true},
+}
+
+// makeTables makes a table for each benchmark that has results.
+func makeTables(res *results) []table {
+	var tables []table
+	for _, spec := range tableSpecs {
+		params := res.parameters(spec.benchmark)
+		if len(params) == 0 {
+			continue
+		}
+		// column keys, without driver
+		var columns []string
+		var keys []key
+		if spec.pivot {
+			for _, p := range params {
+				columns = append(columns, fmt.Sprintf("query/N=%d", p))
+				keys = append(keys, key{spec.benchmark, p, "query", "", "ns"})
+			}
+		} else {
+			for _, phase := range []string{"insert", "query"} {
+				columns = append(columns, phase)
+				keys = append(keys, key{spec.benchmark, params[0], phase, "", "ns"})
+			}
+		}
+		t := table{name: spec.name, columns: columns, drivers: res.drivers}
+		for _, driver := range res.drivers {
+			var row []float64
+			for _, k := range keys {
+				k.driver = driver
+				v, ok := res.median(k)
+				if !ok {
+					v = math.NaN()
+				}
+				row = append(row, v/1e6)
+			}
+			t.values = append(t.values, row)
+		}
+		tables = append(tables, t)
+	}
+	return tables
+}
+
+// lines formats a table in the semicolon layout of results.csv.
+func (t table) lines() []string {
+	header := fmt.Sprintf("%-12s", t.name+";")
+	for _, col := range t.columns {
+		header += fmt.Sprintf(" %*s", max(7, len(col)+1), col+";")
+	}
+	lines := []string{header}
+	for i, driver := range t.drivers {
+		line := fmt.Sprintf("%-12s", driver+";")
+		for j, col := range t.columns {
+			s := "-"
+			if v := t.values[i][j]; !math.IsNaN(v) {
+				s = fmt.Sprintf("%.0f", v)
+			}
+			line += fmt.Sprintf(" %*s", max(7, len(col)+1), s+";")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// writeCsv writes all tables into a csv file, separated by blank lines.
+func writeCsv(filename string, tables []table) {
+	var sb strings.Builder
+	for i, t := range tables {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		for _, line := range t.lines() {
+			sb.WriteString(line + "\n")
+		}
+	}
+	err := os.WriteFile(filename, []byte(sb.String()), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// updateReadme replaces the result tables in a README file. A table is an
+// indented block that starts with the table name followed by a semicolon.
+func updateReadme(filename string, tables []table) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	const indent = "    "
+	lines := strings.Split(string(data), "\n")
+	for _, t := range tables {
+		start := -1
+		for i, line := range lines {
+			if strings.HasPrefix(line, indent+t.name+";") {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			log.Printf("no table %q found in %s, skipping", t.name, filename)
+			continue
+		}
+		end := start + 1
+		for end < len(lines) && strings.HasPrefix(lines[end], indent) {
+			end++
+		}
+		var block []string
+		for _, line := range t.lines() {
+			block = append(block, indent+line)
+		}
+		lines = append(lines[:start], append(block, lines[end:]...)...)
+	}
+	err = os.WriteFile(filename, []byte(strings.Join(lines, "\n")), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestWriteCsv parses the tables of results/results.csv and checks that
+// writing them again reproduces the file byte by byte.
+func TestWriteCsv(t *testing.T) {
+	want, err := os.ReadFile("../../results/results.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []table
+	for _, block := range strings.Split(strings.TrimSuffix(string(want), "\n"), "\n\n") {
+		lines := strings.Split(block, "\n")
+		header := splitLine(lines[0])
+		tab := table{name: header[0], columns: header[1:]}
+		for _, line := range lines[1:] {
+			fields := splitLine(line)
+			tab.drivers = append(tab.drivers, fields[0])
+			var row []float64
+			for _, f := range fields[1:] {
+				v, err := strconv.ParseFloat(f, 64)
+				if err != nil {
+					t.Fatalf("invalid value %q in line %q", f, line)
+				}
+				row = append(row, v)
+			}
+			tab.values = append(tab.values, row)
+		}
+		tables = append(tables, tab)
+	}
+	if len(tables) != len(tableSpecs) {
+		t.Fatalf("want %d tables in results.csv, got %d", len(tableSpecs), len(tables))
+	}
+	filename := filepath.Join(t.TempDir(), "results.csv")
+	writeCsv(filename, tables)
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("writeCsv wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// splitLine splits a semicolon table line into its trimmed fields.
+func splitLine(line string) []string {
+	var fields []string
+	for _, f := range strings.Split(strings.TrimSuffix(line, ";"), ";") {
+		fields = append(fields, strings.TrimSpace(f))
+	}
+	return fields
+}
+
+func TestMakeTables(t *testing.T) {
+	res := &results{
+		values: map[key][]float64{
+			{"simple", 0, "insert", "craw", "ns"}:     {1.2e9, 1.4e9, 1.3e9},
+			{"simple", 0, "query", "craw", "ns"}:      {5.6e8},
+			{"simple", 0, "insert", "mattn", "ns"}:    {1.5e9, 1.6e9},
+			{"simple", 0, "query", "mattn", "ns/row"}: {42},
+			{"many", 10, "query", "craw", "ns"}:       {13e6},
+			{"many", 100, "query", "craw", "ns"}:      {61e6},
+			{"many", 100, "query", "mattn", "ns"}:     {123e6},
+		},
+		drivers: []string{"craw", "mattn"},
+	}
+	tables := makeTables(res)
+	var got []string
+	for _, tab := range tables {
+		got = append(got, tab.lines()...)
+	}
+	want := []string{
+		"Simple;      insert;  query;",
+		"craw;          1300;    560;",
+		"mattn;         1550;      -;",
+		"Many;        query/N=10; query/N=100;",
+		"craw;                13;          61;",
+		"mattn;                -;         123;",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("table lines:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if v := tables[0].values[1][1]; !math.IsNaN(v) {
+		t.Fatalf("want NaN for a missing value, got %g", v)
+	}
+}
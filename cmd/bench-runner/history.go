@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql"
+	"debug/buildinfo"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/cvilsmeier/go-sqlite-bench/app"
+	_ "modernc.org/sqlite"
+)
+
+// historySchema is the schema of the history database. A run is one
+// invocation of bench-runner, on a machine described by cpu, kernel and
+// gomaxprocs. A binary is the benchmark binary of a driver used in a run,
+// with the SQLite library and the modules it was built with. A failed
+// measurement has an error message and a value of 0.
+var historySchema = []string{
+	"PRAGMA foreign_keys=1",
+	"PRAGMA busy_timeout=5000",
+	"CREATE TABLE IF NOT EXISTS runs (" +
+		"id INTEGER PRIMARY KEY NOT NULL," +
+		" started INTEGER NOT NULL," + // time.Time
+		" gitCommit TEXT NOT NULL," +
+		" host TEXT NOT NULL," +
+		" goos TEXT NOT NULL," +
+		" goarch TEXT NOT NULL," +
+		" gomaxprocs INTEGER NOT NULL DEFAULT 0," +
+		" cpu TEXT NOT NULL DEFAULT ''," +
+		" kernel TEXT NOT NULL DEFAULT '')",
+	"CREATE INDEX IF NOT EXISTS runs_started ON runs(started)",
+	"CREATE TABLE IF NOT EXISTS binaries (" +
+		"runId INTEGER NOT NULL REFERENCES runs(id)," +
+		" driver TEXT NOT NULL," +
+		" goVersion TEXT NOT NULL," +
+		" driverModule TEXT NOT NULL," +
+		" driverVersion TEXT NOT NULL," +
+		" sqliteVersion TEXT NOT NULL DEFAULT ''," +
+		" compileOptions TEXT NOT NULL DEFAULT ''," + // space-separated
+		" PRIMARY KEY (runId, driver))",
+	"CREATE TABLE IF NOT EXISTS modules (" +
+		"runId INTEGER NOT NULL," +
+		" driver TEXT NOT NULL," +
+		" path TEXT NOT NULL," +
+		" version TEXT NOT NULL," +
+		" PRIMARY KEY (runId, driver, path)," +
+		" FOREIGN KEY (runId, driver) REFERENCES binaries(runId, driver))",
+	"CREATE TABLE IF NOT EXISTS measurements (" +
+		"runId INTEGER NOT NULL REFERENCES runs(id)," +
+		" benchmark TEXT NOT NULL," +
+		" parameter INTEGER NOT NULL," +
+		" phase TEXT NOT NULL," +
+		" driver TEXT NOT NULL," +
+		" unit TEXT NOT NULL," +
+		" round INTEGER NOT NULL," +
+		" iteration INTEGER NOT NULL," +
+		" value REAL NOT NULL," +
+		" journalMode TEXT NOT NULL DEFAULT '" + app.DefaultJournalMode + "'," +
+		" synchronous TEXT NOT NULL DEFAULT '" + app.DefaultSynchronous + "'," +
+		" error TEXT NOT NULL DEFAULT '')", // "" if the measurement succeeded
+	"CREATE INDEX IF NOT EXISTS measurements_runId ON measurements(runId)",
+}
+
+// historyIndexes are created after the migrations, since they may cover
+// migrated columns. The measurements_trend index serves the queries of
+// bench-history, it replaces measurements_benchmark, which did not cover
+// the pragmas.
+var historyIndexes = []string{
+	"DROP INDEX IF EXISTS measurements_benchmark",
+	"CREATE INDEX IF NOT EXISTS measurements_trend ON measurements(benchmark, parameter, phase, unit, journalMode, synchronous, driver)",
+}
+
+// historyMigrations add the columns that were added to the schema after
+// a history database was created. Each one runs if its column is missing.
+var historyMigrations = []struct {
+	table, column, sql string
+}{
+	{"measurements", "journalMode", "ALTER TABLE measurements ADD COLUMN journalMode TEXT NOT NULL DEFAULT '" + app.DefaultJournalMode + "'"},
+	{"measurements", "synchronous", "ALTER TABLE measurements ADD COLUMN synchronous TEXT NOT NULL DEFAULT '" + app.DefaultSynchronous + "'"},
+	{"measurements", "error", "ALTER TABLE measurements ADD COLUMN error TEXT NOT NULL DEFAULT ''"},
+	{"runs", "gomaxprocs", "ALTER TABLE runs ADD COLUMN gomaxprocs INTEGER NOT NULL DEFAULT 0"},
+	{"runs", "cpu", "ALTER TABLE runs ADD COLUMN cpu TEXT NOT NULL DEFAULT ''"},
+	{"runs", "kernel", "ALTER TABLE runs ADD COLUMN kernel TEXT NOT NULL DEFAULT ''"},
+	{"binaries", "sqliteVersion", "ALTER TABLE binaries ADD COLUMN sqliteVersion TEXT NOT NULL DEFAULT ''"},
+	{"binaries", "compileOptions", "ALTER TABLE binaries ADD COLUMN compileOptions TEXT NOT NULL DEFAULT ''"},
+}
+
+// openHistory opens the history database, creates its schema and migrates
+// databases that were created with an older schema. Measurements of older
+// databases were taken with the default pragmas, their environment is
+// unknown.
+func openHistory(filename string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range historySchema {
+		if _, err := db.Exec(s); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	for _, m := range historyMigrations {
+		var n int
+		err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", m.table, m.column).Scan(&n)
+		if err == nil && n == 0 {
+			_, err = db.Exec(m.sql)
+		}
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	for _, s := range historyIndexes {
+		if _, err := db.Exec(s); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// appendHistory appends a run with the environments of its binaries and all
+// its records to the history database and returns the number of
+// measurements appended.
+func appendHistory(filename string, started time.Time, binaries map[string]string, envs []app.Env, records []app.Record) (int, error) {
+	// all binaries of a run share the machine, each has its own SQLite
+	var machine app.Env
+	driverEnvs := make(map[string]app.Env)
+	for _, env := range envs {
+		machine = env
+		driverEnvs[env.Driver] = env
+	}
+	db, err := openHistory(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	host, _ := os.Hostname()
+	res, err := tx.Exec("INSERT INTO runs(started,gitCommit,host,goos,goarch,gomaxprocs,cpu,kernel) VALUES(?,?,?,?,?,?,?,?)",
+		app.BindTime(started), gitCommit(), host, runtime.GOOS, runtime.GOARCH, machine.GOMAXPROCS, machine.CPU, machine.Kernel)
+	if err != nil {
+		return 0, err
+	}
+	runId, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for driver, binary := range binaries {
+		info, err := buildinfo.ReadFile(binary)
+		if err != nil {
+			return 0, err
+		}
+		module := app.DriverModules[driver]
+		var version string
+		for _, dep := range info.Deps {
+			if dep.Path == module {
+				version = dep.Version
+			}
+		}
+		env := driverEnvs[driver]
+		_, err = tx.Exec("INSERT INTO binaries(runId,driver,goVersion,driverModule,driverVersion,sqliteVersion,compileOptions) VALUES(?,?,?,?,?,?,?)",
+			runId, driver, info.GoVersion, module, version, env.SqliteVersion, strings.Join(env.CompileOptions, " "))
+		if err != nil {
+			return 0, err
+		}
+		for _, dep := range info.Deps {
+			_, err = tx.Exec("INSERT INTO modules(runId,driver,path,version) VALUES(?,?,?,?)",
+				runId, driver, dep.Path, dep.Version)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	stmt, err := tx.Prepare("INSERT INTO measurements(runId,benchmark,parameter,phase,driver,unit,round,iteration,value,journalMode,synchronous,error) VALUES(?,?,?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, r := range records {
+		_, err = stmt.Exec(runId, r.Benchmark, r.Parameter, r.Phase, r.Driver, r.Unit, r.Round, r.Iteration, r.Value, r.JournalMode, r.Synchronous, r.Error)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// gitCommit returns the current git commit, with a "-dirty" suffix if the
+// working tree has changes, or "" if it cannot be determined.
+func gitCommit() string {
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	commit := strings.TrimSpace(string(out))
+	out, err = exec.Command("git", "status", "--porcelain").Output()
+	if err == nil && len(strings.TrimSpace(string(out))) > 0 {
+		commit += "-dirty"
+	}
+	return commit
+}
@@ -0,0 +1,178 @@
+// Command bench-runner builds and runs the benchmark binaries of all
+// drivers. It runs them for a number of rounds, in a random order per
+// round, so that ordering effects and thermal drift do not favour a
+// specific driver. The json output of all runs is collected into one
+// results file, and optionally appended to a history database.
+//
+// It must be run from the repository root. Flags after "--" are passed
+// to the benchmark binaries:
+//
+//	go run ./cmd/bench-runner -rounds 3 -- -bench simple,complex
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/cvilsmeier/go-sqlite-bench/app"
+)
+
+const allDrivers = "craw,eaton,mattn,modernc,ncruces,sqinn,zombie"
+
+func main() {
+	log.SetFlags(0)
+	driversFlag := flag.String("drivers", allDrivers, "comma-separated list of drivers to run")
+	roundsFlag := flag.Int("rounds", 2, "number of rounds")
+	buildFlag := flag.Bool("build", true, "build the benchmark binaries before running them")
+	bindirFlag := flag.String("bindir", "bin", "directory of the benchmark binaries")
+	dbfileFlag := flag.String("dbfile", "bench.db", "database file used by the benchmarks")
+	outFlag := flag.String("out", "results/out.jsonl", "results file")
+	historyFlag := flag.String("history", "", "history database to append results to, empty to skip")
+	seedFlag := flag.Int64("seed", 0, "random seed for the run order, 0 means current time")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [-- benchmark flags]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	drivers := app.SplitList(*driversFlag)
+	if len(drivers) == 0 {
+		log.Fatalf("invalid drivers %q, must not be empty", *driversFlag)
+	}
+	for _, driver := range drivers {
+		if !slices.Contains(app.SplitList(allDrivers), driver) {
+			log.Fatalf("unknown driver %q, must be one of %s", driver, allDrivers)
+		}
+	}
+	if *roundsFlag < 1 {
+		log.Fatalf("invalid rounds %d, must be >= 1", *roundsFlag)
+	}
+	// build or locate binaries
+	binaries := make(map[string]string)
+	for _, driver := range drivers {
+		binaries[driver] = locate(*bindirFlag, driver, *buildFlag)
+	}
+	// run binaries in random order, round after round
+	seed := *seedFlag
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Printf("seed %d", seed)
+	started := time.Now()
+	rnd := rand.New(rand.NewSource(seed))
+	var envs []app.Env
+	var records []app.Record
+	for round := 1; round <= *roundsFlag; round++ {
+		for _, i := range rnd.Perm(len(drivers)) {
+			driver := drivers[i]
+			log.Printf("%s round %d/%d: %s", time.Now().Format(time.TimeOnly), round, *roundsFlag, driver)
+			runEnvs, runRecords := run(binaries[driver], flag.Args(), *dbfileFlag)
+			envs = append(envs, runEnvs...)
+			for _, rec := range runRecords {
+				rec.Round = round
+				records = append(records, rec)
+			}
+		}
+	}
+	// write results
+	write(*outFlag, envs, records)
+	log.Printf("%d records written to %s", len(records), *outFlag)
+	if *historyFlag != "" {
+		n, err := appendHistory(*historyFlag, started, binaries, envs, records)
+		if err != nil {
+			log.Fatalf("cannot append to history %s: %s", *historyFlag, err)
+		}
+		log.Printf("%d records appended to %s", n, *historyFlag)
+	}
+}
+
+// locate returns the path of the benchmark binary for a driver, building
+// it first if build is true.
+func locate(bindir string, driver string, build bool) string {
+	name := "bench-" + driver
+	path := filepath.Join(bindir, name)
+	if build {
+		log.Printf("build %s", name)
+		cmd := exec.Command("go", "build", "-o", path, "./cmd/"+name)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		if err != nil {
+			log.Fatalf("cannot build %s: %s", name, err)
+		}
+		return path
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		log.Fatalf("cannot find %s in %s or PATH", name, bindir)
+	}
+	return path
+}
+
+// run runs a benchmark binary and returns its environment and records.
+// A binary that fails after writing records had failed benchmark
+// iterations, which are reported in its records, so its output is used
+// anyway.
+func run(binary string, args []string, dbfile string) ([]app.Env, []app.Record) {
+	args = append([]string{"-output", "json"}, args...)
+	args = append(args, dbfile)
+	var stdout bytes.Buffer
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	runErr := cmd.Run()
+	envs, records, err := app.ReadOutput(&stdout)
+	if err != nil {
+		log.Fatalf("cannot read output of %s: %s", binary, err)
+	}
+	if runErr != nil {
+		if len(records) == 0 {
+			log.Fatalf("%s failed: %s", binary, runErr)
+		}
+		var nfailed int
+		for _, rec := range records {
+			if rec.Error != "" {
+				nfailed++
+			}
+		}
+		log.Printf("%s failed: %s, %d failed iterations", binary, runErr, nfailed)
+	}
+	return envs, records
+}
+
+// write writes environments and records to a file, one json object per
+// line.
+func write(filename string, envs []app.Env, records []app.Record) {
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, env := range envs {
+		err = app.WriteEnv(f, env)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	enc := json.NewEncoder(f)
+	for _, rec := range records {
+		err = enc.Encode(rec)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	err = f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
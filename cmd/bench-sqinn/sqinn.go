@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 
 	"github.com/cvilsmeier/go-sqlite-bench/app"
@@ -8,36 +9,102 @@ import (
 )
 
 func main() {
-	app.Run(func(dbfile string) app.Db {
+	app.Run(func(dbfile string) (app.Db, error) {
 		return newDb(dbfile)
 	})
 }
 
+// dbImpl talks to a sqinn child process, which has no way to interrupt a
+// running request. Cancellation is therefore only checked before each
+// request is sent, and the cancel benchmark reports sqinn as unsupported.
 type dbImpl struct {
 	sq *sqinn.Sqinn
 }
 
 var _ app.Db = (*dbImpl)(nil)
 
-func newDb(dbfile string) app.Db {
-	sq := sqinn.MustLaunch(sqinn.Options{SqinnPath: os.Getenv("SQINN_PATH")})
-	sq.MustOpen(dbfile)
-	sq.MustExecOne("PRAGMA foreign_keys=1")
-	return &dbImpl{sq}
+func newDb(dbfile string) (app.Db, error) {
+	sq, err := sqinn.Launch(sqinn.Options{SqinnPath: os.Getenv("SQINN_PATH")})
+	if err != nil {
+		return nil, err
+	}
+	d := &dbImpl{sq}
+	err = sq.Open(dbfile)
+	if err == nil {
+		_, err = sq.ExecOne("PRAGMA foreign_keys=1")
+	}
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
 }
 
 func (d *dbImpl) DriverName() string {
 	return "sqinn"
 }
 
-func (d *dbImpl) Exec(sqls ...string) {
+func (d *dbImpl) SqliteVersion(ctx context.Context) (string, error) {
+	texts, err := d.queryTexts(ctx, "SELECT sqlite_version()")
+	if err != nil {
+		return "", err
+	}
+	return texts[0], nil
+}
+
+func (d *dbImpl) CompileOptions(ctx context.Context) ([]string, error) {
+	return d.queryTexts(ctx, "PRAGMA compile_options")
+}
+
+// queryTexts returns the first column of all rows of a query.
+func (d *dbImpl) queryTexts(ctx context.Context, sql string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := d.sq.Query(sql, nil, []byte{sqinn.ValText})
+	if err != nil {
+		return nil, err
+	}
+	texts := make([]string, len(rows))
+	for i, row := range rows {
+		texts[i] = row.Values[0].AsString()
+	}
+	return texts, nil
+}
+
+func (d *dbImpl) Exec(ctx context.Context, sqls ...string) error {
 	for _, s := range sqls {
-		d.sq.MustExecOne(s)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, err := d.sq.ExecOne(s)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (d *dbImpl) InsertUsers(insertSql string, users []app.User) {
-	d.sq.MustExecOne("BEGIN")
+// execRows executes sql for all rows in one transaction, which is rolled
+// back if it fails.
+func (d *dbImpl) execRows(ctx context.Context, sql string, nrows int, nparams int, values []any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := d.sq.ExecOne("BEGIN")
+	if err != nil {
+		return err
+	}
+	_, err = d.sq.Exec(sql, nrows, nparams, values)
+	if err != nil {
+		d.sq.ExecOne("ROLLBACK")
+		return err
+	}
+	_, err = d.sq.ExecOne("COMMIT")
+	return err
+}
+
+func (d *dbImpl) InsertUsers(ctx context.Context, insertSql string, users []app.User) error {
 	const nparams = 4
 	values := make([]any, 0, nparams*len(users))
 	for _, u := range users {
@@ -48,12 +115,10 @@ func (d *dbImpl) InsertUsers(insertSql string, users []app.User) {
 			bindBool(u.Active),
 		)
 	}
-	d.sq.MustExec(insertSql, len(users), nparams, values)
-	d.sq.MustExecOne("COMMIT")
+	return d.execRows(ctx, insertSql, len(users), nparams, values)
 }
 
-func (d *dbImpl) InsertArticles(insertSql string, articles []app.Article) {
-	d.sq.MustExecOne("BEGIN")
+func (d *dbImpl) InsertArticles(ctx context.Context, insertSql string, articles []app.Article) error {
 	const nparams = 4
 	values := make([]any, 0, nparams*len(articles))
 	for _, u := range articles {
@@ -64,12 +129,10 @@ func (d *dbImpl) InsertArticles(insertSql string, articles []app.Article) {
 			u.Text,
 		)
 	}
-	d.sq.MustExec(insertSql, len(articles), nparams, values)
-	d.sq.MustExecOne("COMMIT")
+	return d.execRows(ctx, insertSql, len(articles), nparams, values)
 }
 
-func (d *dbImpl) InsertComments(insertSql string, comments []app.Comment) {
-	d.sq.MustExecOne("BEGIN")
+func (d *dbImpl) InsertComments(ctx context.Context, insertSql string, comments []app.Comment) error {
 	const nparams = 4
 	values := make([]any, 0, nparams*len(comments))
 	for _, u := range comments {
@@ -80,26 +143,59 @@ func (d *dbImpl) InsertComments(insertSql string, comments []app.Comment) {
 			u.Text,
 		)
 	}
-	d.sq.MustExec(insertSql, len(comments), nparams, values)
-	d.sq.MustExecOne("COMMIT")
+	return d.execRows(ctx, insertSql, len(comments), nparams, values)
+}
+
+func (d *dbImpl) UpdateUsers(ctx context.Context, updateSql string, users []app.User) error {
+	const nparams = 4
+	values := make([]any, 0, nparams*len(users))
+	for _, u := range users {
+		values = append(values,
+			app.BindTime(u.Created),
+			u.Email,
+			bindBool(u.Active),
+			u.Id,
+		)
+	}
+	return d.execRows(ctx, updateSql, len(users), nparams, values)
 }
 
-func (d *dbImpl) FindUsers(querySql string) []app.User {
-	rows := d.sq.MustQuery(querySql, nil, []byte{sqinn.ValInt, sqinn.ValInt64, sqinn.ValText, sqinn.ValInt, sqinn.ValInt64})
+func (d *dbImpl) DeleteByIds(ctx context.Context, deleteSql string, ids []int) error {
+	values := make([]any, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	return d.execRows(ctx, deleteSql, len(ids), 1, values)
+}
+
+func (d *dbImpl) FindUsers(ctx context.Context, querySql string) ([]app.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := d.sq.Query(querySql, nil, []byte{sqinn.ValInt, sqinn.ValInt64, sqinn.ValText, sqinn.ValInt})
+	if err != nil {
+		return nil, err
+	}
 	users := make([]app.User, len(rows))
 	for i, row := range rows {
 		users[i] = readUser(row.Values, 0)
 	}
-	return users
+	return users, nil
 }
 
-func (d *dbImpl) FindUsersArticlesComments(querySql string) ([]app.User, []app.Article, []app.Comment) {
+func (d *dbImpl) FindUsersArticlesComments(ctx context.Context, querySql string) ([]app.User, []app.Article, []app.Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
 	coltypes := []byte{
 		sqinn.ValInt, sqinn.ValInt64, sqinn.ValText, sqinn.ValInt, // User
 		sqinn.ValInt, sqinn.ValInt64, sqinn.ValInt, sqinn.ValText, // Article
 		sqinn.ValInt, sqinn.ValInt64, sqinn.ValInt, sqinn.ValText, // Comment
 	}
-	rows := d.sq.MustQuery(querySql, nil, coltypes)
+	rows, err := d.sq.Query(querySql, nil, coltypes)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	// collections
 	var users []app.User
 	userIndexer := make(map[int]int)
@@ -127,14 +223,117 @@ func (d *dbImpl) FindUsersArticlesComments(querySql string) ([]app.User, []app.A
 			comments = append(comments, comment)
 		}
 	}
-	return users, articles, comments
+	return users, articles, comments, nil
+}
+
+// ScanUsers calls fn for each row. Note that sqinn transfers the complete
+// result set from the child process before the first row can be scanned.
+func (d *dbImpl) ScanUsers(ctx context.Context, querySql string, fn func(app.User) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rows, err := d.sq.Query(querySql, nil, []byte{sqinn.ValInt, sqinn.ValInt64, sqinn.ValText, sqinn.ValInt})
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		err = fn(readUser(row.Values, 0))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (d *dbImpl) Close() {
+// ScanUsersArticlesComments calls fn for each row. Like ScanUsers, it
+// receives the complete result set first.
+func (d *dbImpl) ScanUsersArticlesComments(ctx context.Context, querySql string, fn func(app.User, app.Article, app.Comment) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	coltypes := []byte{
+		sqinn.ValInt, sqinn.ValInt64, sqinn.ValText, sqinn.ValInt, // User
+		sqinn.ValInt, sqinn.ValInt64, sqinn.ValInt, sqinn.ValText, // Article
+		sqinn.ValInt, sqinn.ValInt64, sqinn.ValInt, sqinn.ValText, // Comment
+	}
+	rows, err := d.sq.Query(querySql, nil, coltypes)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		err = fn(readUser(row.Values, 0), readArticle(row.Values, 4), readComment(row.Values, 8))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindUsersById uses the low-level statement API of sqinn, so that the
+// statement is prepared only once. Each bind, step, column and reset is a
+// request to the child process.
+func (d *dbImpl) FindUsersById(ctx context.Context, querySql string, ids []int, fn func(app.User) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := d.sq.Prepare(querySql)
+	if err != nil {
+		return err
+	}
+	defer d.sq.Finalize()
+	coltypes := []byte{sqinn.ValInt, sqinn.ValInt64, sqinn.ValText, sqinn.ValInt}
+	values := make([]sqinn.AnyValue, len(coltypes))
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err = d.sq.Bind(1, id)
+		if err != nil {
+			return err
+		}
+		found, err := d.sq.Step()
+		if err != nil {
+			return err
+		}
+		if found {
+			for i, coltype := range coltypes {
+				values[i], err = d.sq.Column(i, coltype)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		err = d.sq.Reset()
+		if err != nil {
+			return err
+		}
+		if found {
+			err = fn(readUser(values, 0))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// IsInterrupt returns false, since sqinn cannot interrupt a running
+// statement.
+func (d *dbImpl) IsInterrupt(err error) bool {
+	return false
+}
+
+// CannotInterrupt marks sqinn as a driver that cannot interrupt a running
+// statement.
+func (d *dbImpl) CannotInterrupt() {}
+
+func (d *dbImpl) Close() error {
 	err := d.sq.Close()
-	app.MustBeNil(err)
-	err = d.sq.Terminate()
-	app.MustBeNil(err)
+	if err != nil {
+		d.sq.Terminate()
+		return err
+	}
+	return d.sq.Terminate()
 }
 
 func readUser(values []sqinn.AnyValue, off int) app.User {